@@ -2,9 +2,11 @@ package bitcask_go
 
 import (
 	"bitcask-go/data"
+	"bitcask-go/index"
 	"encoding/binary"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const nonTransactionSeqNo uint64 = 0
@@ -21,9 +23,6 @@ type WriteBatch struct {
 
 // NewWriteBatch 初始化 WriteBatch
 func (db *DB) NewWriteBatch(opts WriteBatchOptions) *WriteBatch {
-	if db.options.IndexType == BPlusTree && !db.seqNoFileExists && !db.isInitial {
-		panic("cannot use write batch, seq no file not exists")
-	}
 	return &WriteBatch{
 		options:       opts,
 		mu:            new(sync.Mutex),
@@ -37,6 +36,9 @@ func (wb *WriteBatch) Put(key []byte, value []byte) error {
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
+	if err := wb.db.checkKeyValueSize(key, value); err != nil {
+		return err
+	}
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
 
@@ -51,6 +53,9 @@ func (wb *WriteBatch) Delete(key []byte) error {
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
+	if err := wb.db.checkKeyValueSize(key, nil); err != nil {
+		return err
+	}
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
 
@@ -85,17 +90,28 @@ func (wb *WriteBatch) Commit() error {
 	wb.db.mu.Lock()
 	defer wb.db.mu.Unlock()
 
+	// 磁盘剩余空间不足时直接拒绝提交，避免写入一部分数据
+	if wb.db.diskFull.Load() {
+		return ErrDiskFull
+	}
+
 	// 获取当前最新的事务序列号
 	seqNo := atomic.AddUint64(&wb.db.seqNo, 1)
 
-	// 开始写数据到数据文件当中
+	// 开始写数据到数据文件当中，开启多版本时同一个批次的数据使用相同的序列号和写入时间
 	positions := make(map[string]*data.LogRecordPos)
+	versions := make(map[string]*keyVersion)
+	timestamp := time.Now().UnixNano()
 	for _, record := range wb.pendingWrites {
-		logRecordPos, err := wb.db.appendLogRecord(&data.LogRecord{
+		logRecord := &data.LogRecord{
 			Key:   logRecordKeyWithSeq(record.Key, seqNo),
 			Value: record.Value,
 			Type:  record.Type,
-		})
+		}
+		if wb.db.versioned() {
+			versions[string(record.Key)] = withVersion(logRecord, seqNo, timestamp)
+		}
+		logRecordPos, err := wb.db.writeLogRecord(logRecord)
 		if err != nil {
 			return err
 		}
@@ -107,32 +123,52 @@ func (wb *WriteBatch) Commit() error {
 		Key:  logRecordKeyWithSeq(txnFinKey, seqNo),
 		Type: data.LogRecordTxnFinished,
 	}
-	if _, err := wb.db.appendLogRecord(finishedRecord); err != nil {
+	if _, err := wb.db.writeLogRecord(finishedRecord); err != nil {
 		return err
 	}
 
-	// 根据配置决定是否持久化
-	if wb.options.SyncWrites && wb.db.activeFile != nil {
-		if err := wb.db.activeFile.Sync(); err != nil {
-			return err
-		}
+	// 根据配置决定是否持久化，和单条写入的规则一致，整个批次只持久化一次
+	if err := wb.db.syncIfNeeded(wb.options.SyncWrites); err != nil {
+		return err
 	}
 
 	// 更新内存索引
+	var putKeys, deleteKeys [][]byte
+	var putPositions []*data.LogRecordPos
 	for _, record := range wb.pendingWrites {
-		pos := positions[string(record.Key)]
-		var oldPos *data.LogRecordPos
-		if record.Type == data.LogRecordNormal {
-			oldPos = wb.db.index.Put(record.Key, pos)
-		}
 		if record.Type == data.LogRecordDeleted {
-			oldPos, _ = wb.db.index.Delete(record.Key)
+			deleteKeys = append(deleteKeys, record.Key)
+		} else {
+			putKeys = append(putKeys, record.Key)
+			putPositions = append(putPositions, positions[string(record.Key)])
 		}
-		if oldPos != nil {
-			wb.db.reclaimSize += int64(oldPos.Size)
+	}
+	var oldPositions []*data.LogRecordPos
+	if bpt, ok := wb.db.index.(*index.BPlusTree); ok {
+		// B+ 树索引的删除、写入、已经应用的位置和事务序列号在同一个事务中持久化，崩溃时最多重放整个批次
+		bpt.SetSeqNo(seqNo)
+		oldPositions = bpt.ApplyBatch(putKeys, putPositions, deleteKeys)
+	} else {
+		oldPositions = wb.db.index.DeleteBatch(deleteKeys)
+		oldPositions = append(oldPositions, wb.db.index.PutBatch(putKeys, putPositions)...)
+	}
+	if wb.db.versioned() {
+		// 旧的版本按照保留策略清理之后才可以回收
+		for key, version := range versions {
+			version.pos = positions[key]
+			wb.db.addVersion([]byte(key), version)
+		}
+	} else {
+		for _, oldPos := range oldPositions {
+			if oldPos != nil {
+				wb.db.reclaimSize += int64(oldPos.Size)
+			}
 		}
 	}
 
+	wb.db.options.Metrics.IncCounter(MetricBatchCommitsTotal, 1)
+	wb.db.options.Metrics.Observe(MetricBatchCommitSize, float64(len(wb.pendingWrites)))
+
 	// 清空暂存数据
 	wb.pendingWrites = make(map[string]*data.LogRecord)
 
@@ -1,6 +1,7 @@
 package bitcask_go
 
 import (
+	"bitcask-go/data"
 	"bitcask-go/utils"
 	"github.com/stretchr/testify/assert"
 	"os"
@@ -85,6 +86,58 @@ func TestDB_WriteBatch2(t *testing.T) {
 	assert.Equal(t, uint64(2), db2.seqNo)
 }
 
+func TestDB_WriteBatchBPlusTreeCrash(t *testing.T) {
+	// 同步和异步更新 B+ 树索引
+	for _, batchSize := range []int{0, 16} {
+		testWriteBatchBPlusTreeCrash(t, batchSize)
+	}
+}
+
+func testWriteBatchBPlusTreeCrash(t *testing.T, batchSize int) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-batch-bptree")
+	opts.DirPath = dir
+	opts.IndexType = BPlusTree
+	opts.BPlusTreeAsyncBatchSize = batchSize
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Put(utils.GetTestKey(1), utils.RandomValue(10)))
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put(utils.GetTestKey(2), utils.RandomValue(10)))
+	assert.Nil(t, wb.Put(utils.GetTestKey(3), utils.RandomValue(10)))
+	assert.Nil(t, wb.Commit())
+
+	// 写入数据文件之后还没有更新索引时崩溃
+	_, err = db.appendLogRecordWithLock(&data.LogRecord{
+		Key:   logRecordKeyWithSeq(utils.GetTestKey(4), nonTransactionSeqNo),
+		Value: utils.RandomValue(10),
+	}, DefaultWriteOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, db.activeFile.Close())
+	assert.Nil(t, db.index.Close())
+	assert.Nil(t, db.fileLock.Close())
+
+	// 重新打开时只重放索引中记录的位置之后的数据
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer destroyDB(db2)
+	// 事务完成标识和崩溃之前写入的记录
+	assert.Equal(t, 2, db2.recovery.DataRecords)
+	assert.Equal(t, uint64(1), db2.seqNo)
+	for i := 1; i <= 4; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+
+	// 崩溃之后仍然可以使用 WriteBatch
+	wb2 := db2.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb2.Put(utils.GetTestKey(5), utils.RandomValue(10)))
+	assert.Nil(t, wb2.Commit())
+	assert.Equal(t, uint64(2), db2.seqNo)
+	assert.Equal(t, 5, len(db2.ListKeys()))
+}
+
 //func TestDB_WriteBatch3(t *testing.T) {
 //	opts := DefaultOptions
 //	//dir, _ := os.MkdirTemp("", "bitcask-go-batch-3")
@@ -0,0 +1,200 @@
+package main
+
+import (
+	bitcask "bitcask-go"
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// bitcask-cli 数据目录的运维工具，不带子命令时进入交互模式
+//
+//	bitcask-cli --dir /tmp/bitcask-go put name bitcask
+//	bitcask-cli --dir /tmp/bitcask-go scan --prefix na --limit 10
+//	bitcask-cli --dir /tmp/bitcask-go --index bptree
+func main() {
+	dir := flag.String("dir", "", "database directory")
+	indexType := flag.String("index", "btree", "index type: btree, art, bptree, hash or skiplist")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bitcask-cli --dir <dir> [--index btree|art|bptree|hash|skiplist] [command [args]]")
+		fmt.Fprintln(os.Stderr, "\ncommands:")
+		fmt.Fprint(os.Stderr, commandsHelp)
+		fmt.Fprintln(os.Stderr, "\nflags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "--dir is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options := bitcask.DefaultOptions
+	options.DirPath = *dir
+	switch *indexType {
+	case "btree":
+		options.IndexType = bitcask.BTree
+	case "art":
+		options.IndexType = bitcask.ART
+	case "bptree":
+		options.IndexType = bitcask.BPlusTree
+	case "hash":
+		options.IndexType = bitcask.Hash
+	case "skiplist":
+		options.IndexType = bitcask.SkipList
+	default:
+		fmt.Fprintf(os.Stderr, "unknown index type %q\n", *indexType)
+		os.Exit(2)
+	}
+
+	db, err := bitcask.Open(options)
+	if err != nil {
+		if err == bitcask.ErrDatabaseIsUsing {
+			fmt.Fprintf(os.Stderr, "%s is opened by another process\n", *dir)
+		} else {
+			fmt.Fprintf(os.Stderr, "failed to open %s: %v\n", *dir, err)
+		}
+		os.Exit(1)
+	}
+
+	var code int
+	if flag.NArg() == 0 {
+		repl(db, os.Stdin, os.Stdout)
+	} else if err := runCommand(db, flag.Args(), os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	if err := db.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to close %s: %v\n", *dir, err)
+		code = 1
+	}
+	os.Exit(code)
+}
+
+const commandsHelp = `  get <key>                                  print the value of key
+  put <key> <value>                          set key to value
+  delete <key>                               delete key
+  scan [--prefix p] [--reverse] [--limit n]  print keys and values in order
+  keys                                       print all keys
+  stat                                       print database statistics
+  merge                                      reclaim the space of stale records
+  backup <dir>                               copy the data files into dir
+`
+
+var errUsage = errors.New("wrong number of arguments")
+
+// 交互模式，每行一个命令，参数之间用空格分隔
+func repl(db *bitcask.DB, in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprint(out, "bitcask> ")
+	for scanner.Scan() {
+		args := strings.Fields(scanner.Text())
+		switch {
+		case len(args) == 0:
+		case args[0] == "exit" || args[0] == "quit":
+			return
+		case args[0] == "help":
+			fmt.Fprint(out, commandsHelp)
+		default:
+			if err := runCommand(db, args, out); err != nil {
+				fmt.Fprintf(out, "(error) %v\n", err)
+			}
+		}
+		fmt.Fprint(out, "bitcask> ")
+	}
+}
+
+func runCommand(db *bitcask.DB, args []string, out io.Writer) error {
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "get":
+		if len(args) != 1 {
+			return errUsage
+		}
+		value, err := db.Get([]byte(args[0]))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\n", value)
+	case "put":
+		if len(args) != 2 {
+			return errUsage
+		}
+		return db.Put([]byte(args[0]), []byte(args[1]))
+	case "delete":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return db.Delete([]byte(args[0]))
+	case "scan":
+		return scan(db, args, out)
+	case "keys":
+		if len(args) != 0 {
+			return errUsage
+		}
+		for _, key := range db.ListKeys() {
+			fmt.Fprintf(out, "%s\n", key)
+		}
+	case "stat":
+		if len(args) != 0 {
+			return errUsage
+		}
+		stat := db.Stat()
+		fmt.Fprintf(out, "keys:             %d\n", stat.KeyNum)
+		fmt.Fprintf(out, "data files:       %d\n", stat.DataFileNum)
+		fmt.Fprintf(out, "reclaimable size: %d\n", stat.ReclaimableSize)
+		fmt.Fprintf(out, "disk size:        %d\n", stat.DiskSize)
+		fmt.Fprintf(out, "disk full:        %v\n", stat.DiskFull)
+	case "merge":
+		if len(args) != 0 {
+			return errUsage
+		}
+		return db.Merge()
+	case "backup":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return db.Backup(args[0])
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	return nil
+}
+
+func scan(db *bitcask.DB, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	fs.SetOutput(out)
+	prefix := fs.String("prefix", "", "only scan keys with the prefix")
+	reverse := fs.Bool("reverse", false, "scan in descending order")
+	limit := fs.Int("limit", 0, "max number of keys to print, 0 means no limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errUsage
+	}
+
+	iter := db.NewIterator(bitcask.IteratorOptions{Prefix: []byte(*prefix), Reverse: *reverse})
+	defer iter.Close()
+	var count int
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		if *limit > 0 && count >= *limit {
+			break
+		}
+		value, err := iter.Value()
+		if err != nil {
+			// 遍历过程中被删除的 key
+			if err == bitcask.ErrKeyNotFound {
+				continue
+			}
+			return err
+		}
+		fmt.Fprintf(out, "%s\t%s\n", iter.Key(), value)
+		count++
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	bitcask "bitcask-go"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// bitcask-fsck 离线检查数据目录的完整性，可以将能够恢复的数据写入到新的目录中
+//
+//	bitcask-fsck --dir /tmp/bitcask-go
+//	bitcask-fsck --dir /tmp/bitcask-go --repair --out /tmp/bitcask-go-repaired
+func main() {
+	dir := flag.String("dir", "", "database directory to check")
+	repair := flag.Bool("repair", false, "rewrite every salvageable record into the --out directory")
+	out := flag.String("out", "", "destination directory of --repair, must be empty")
+	flag.Parse()
+
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "--dir is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	report, err := bitcask.Verify(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to verify %s: %v\n", *dir, err)
+		os.Exit(2)
+	}
+	printReport(report)
+
+	if *repair {
+		if *out == "" {
+			fmt.Fprintln(os.Stderr, "--out is required by --repair")
+			os.Exit(2)
+		}
+		repairReport, err := bitcask.Repair(*dir, *out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to repair %s: %v\n", *dir, err)
+			os.Exit(2)
+		}
+		fmt.Printf("repaired into %s: %d records written, %d keys, %d corrupt records skipped, %d uncommitted records dropped\n",
+			*out, repairReport.Records, repairReport.Keys, repairReport.CorruptRecords, repairReport.DroppedRecords)
+		return
+	}
+
+	if !report.Healthy() {
+		os.Exit(1)
+	}
+}
+
+func printReport(report *bitcask.VerifyReport) {
+	fmt.Printf("directory:   %s\n", report.DirPath)
+	fmt.Printf("data files:  %d\n", len(report.DataFiles))
+	fmt.Printf("records:     %d (%d bytes)\n", report.Records, report.Bytes)
+	fmt.Printf("hint:        %d records\n", report.HintRecords)
+	if report.SeqNoFileExists {
+		fmt.Printf("seq no:      %d (max in data files %d)\n", report.SeqNo, report.MaxSeqNo)
+	} else {
+		fmt.Printf("seq no:      no seq-no file (max in data files %d)\n", report.MaxSeqNo)
+	}
+
+	for _, c := range report.CorruptRecords {
+		fmt.Printf("CORRUPT      file %09d offset %d: %v\n", c.FileId, c.Offset, c.Err)
+	}
+	for _, h := range report.InvalidHints {
+		fmt.Printf("BAD HINT     key %q -> file %09d offset %d size %d: %s\n", h.Key, h.Pos.Fid, h.Pos.Offset, h.Pos.Size, h.Reason)
+	}
+	if report.SeqNoErr != nil {
+		fmt.Printf("BAD SEQ NO   %v\n", report.SeqNoErr)
+	}
+	for _, txn := range report.UncommittedTxns {
+		fmt.Printf("UNCOMMITTED  txn %d: %d records starting at file %09d offset %d\n", txn.SeqNo, txn.Records, txn.FileId, txn.Offset)
+	}
+	if report.MergeDir != nil {
+		if report.MergeDir.Finished {
+			fmt.Printf("MERGE        %s is finished and will be applied on next open\n", report.MergeDir.Path)
+		} else {
+			fmt.Printf("ORPHAN MERGE %s is unfinished and will be discarded on next open\n", report.MergeDir.Path)
+		}
+	}
+
+	if report.Healthy() {
+		fmt.Println("status:      OK")
+	} else {
+		fmt.Println("status:      CORRUPTED")
+	}
+}
@@ -0,0 +1,238 @@
+package bitcask_go
+
+import (
+	"bitcask-go/fio"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+// crashModel 记录上次持久化之后每次操作完成时数据库的状态
+// 崩溃恢复之后的数据库应该和其中的某一个状态一致，第一个状态是已经持久化的状态
+type crashModel struct {
+	states []map[string]string
+}
+
+func newCrashModel() *crashModel {
+	return &crashModel{states: []map[string]string{{}}}
+}
+
+func (m *crashModel) current() map[string]string {
+	return m.states[len(m.states)-1]
+}
+
+// 在当前状态上执行一次操作
+func (m *crashModel) apply(fn func(state map[string]string)) {
+	m.states = append(m.states, m.next(fn))
+}
+
+func (m *crashModel) next(fn func(state map[string]string)) map[string]string {
+	state := make(map[string]string, len(m.current()))
+	for k, v := range m.current() {
+		state[k] = v
+	}
+	fn(state)
+	return state
+}
+
+// 当前状态已经持久化
+func (m *crashModel) durable() {
+	m.states = []map[string]string{m.current()}
+}
+
+// 一次随机的写操作，fn 是操作成功之后的状态变化，sync 表示操作成功之后数据是否已经持久化
+type crashOp struct {
+	name string
+	run  func(db *DB) error
+	fn   func(state map[string]string)
+	sync bool
+}
+
+func randomCrashOp(rnd *rand.Rand, model *crashModel) crashOp {
+	key := fmt.Sprintf("key-%d", rnd.Intn(50))
+	value := fmt.Sprintf("value-%d", rnd.Int())
+	sync := rnd.Intn(5) == 0
+	switch r := rnd.Intn(10); {
+	case r < 5:
+		return crashOp{
+			name: "put",
+			run: func(db *DB) error {
+				return db.PutWithOptions([]byte(key), []byte(value), WriteOptions{Sync: sync})
+			},
+			fn:   func(state map[string]string) { state[key] = value },
+			sync: sync,
+		}
+	case r < 7:
+		return crashOp{
+			name: "delete",
+			run: func(db *DB) error {
+				return db.DeleteWithOptions([]byte(key), WriteOptions{Sync: sync})
+			},
+			fn: func(state map[string]string) { delete(state, key) },
+			// 删除不存在的 key 不会写入数据，也不会持久化
+			sync: sync && model.current()[key] != "",
+		}
+	default:
+		// 和 WriteBatch 的语义一致，删除不存在的 key 会丢弃之前暂存的写入
+		type batchOp struct {
+			key, value string
+			delete     bool
+		}
+		var ops []batchOp
+		pending := make(map[string]*batchOp)
+		for i := rnd.Intn(5) + 1; i > 0; i-- {
+			op := batchOp{key: fmt.Sprintf("key-%d", rnd.Intn(50)), value: fmt.Sprintf("value-%d", rnd.Int())}
+			op.delete = rnd.Intn(3) == 0
+			ops = append(ops, op)
+			if !op.delete {
+				pending[op.key] = &op
+			} else if _, ok := model.current()[op.key]; ok {
+				pending[op.key] = &op
+			} else {
+				delete(pending, op.key)
+			}
+		}
+		return crashOp{
+			name: "batch",
+			run: func(db *DB) error {
+				wb := db.NewWriteBatch(WriteBatchOptions{MaxBatchNum: 10, SyncWrites: sync})
+				for _, op := range ops {
+					var err error
+					if op.delete {
+						err = wb.Delete([]byte(op.key))
+					} else {
+						err = wb.Put([]byte(op.key), []byte(op.value))
+					}
+					if err != nil {
+						return err
+					}
+				}
+				return wb.Commit()
+			},
+			fn: func(state map[string]string) {
+				for key, op := range pending {
+					if op.delete {
+						delete(state, key)
+					} else {
+						state[key] = op.value
+					}
+				}
+			},
+			sync: sync && len(pending) > 0,
+		}
+	}
+}
+
+// 读取数据库中的所有数据
+func crashDBState(t *testing.T, db *DB) map[string]string {
+	state := make(map[string]string)
+	err := db.Fold(func(key []byte, value []byte) bool {
+		state[string(key)] = string(value)
+		return true
+	})
+	assert.Nil(t, err)
+	return state
+}
+
+// 崩溃之后重新打开，数据库应该恢复到 candidates 中的某一个状态
+// torn 大于 0 时每个文件没有持久化的数据会保留前 torn 个字节，模拟没有写完整的记录
+func crashAndRecover(t *testing.T, fs *fio.FaultFS, opts Options, model *crashModel, candidates []map[string]string, torn int64) *DB {
+	assert.Nil(t, fs.TornCrash(torn))
+	fs.ClearFaults()
+	db, err := Open(opts)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	state := crashDBState(t, db)
+	for _, candidate := range candidates {
+		if assert.ObjectsAreEqual(candidate, state) {
+			model.states = append(model.states, state)
+			model.durable()
+			return db
+		}
+	}
+	t.Fatalf("recovered state %v is not one of the states since the last sync", state)
+	return nil
+}
+
+func TestDB_CrashConsistency(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		seed := seed
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(seed))
+			fs := fio.NewFaultFS(fio.NewMemFS())
+			opts := DefaultOptions
+			opts.DirPath = "/bitcask-go-crash"
+			opts.DataFileSize = 4 * 1024
+			opts.DataFileMergeRatio = 0
+			opts.FS = fs
+			opts.IndexType = []IndexerType{BTree, ART, Hash, SkipList}[seed%4]
+			opts.PreallocateSize = []int64{0, 1024, 4 * 1024}[seed%3]
+			db, err := Open(opts)
+			assert.Nil(t, err)
+			model := newCrashModel()
+
+			for i := 0; i < 300; i++ {
+				switch r := rnd.Intn(100); {
+				case r < 70:
+					op := randomCrashOp(rnd, model)
+					assert.Nil(t, op.run(db), op.name)
+					model.apply(op.fn)
+					if op.sync {
+						model.durable()
+					}
+				case r < 74:
+					assert.Nil(t, db.Merge())
+					model.durable()
+				case r < 78:
+					assert.Nil(t, db.Sync())
+					model.durable()
+				case r < 82:
+					assert.Nil(t, db.Close())
+					db, err = Open(opts)
+					assert.Nil(t, err)
+					model.durable()
+				case r < 88:
+					db = crashAndRecover(t, fs, opts, model, model.states, rnd.Int63n(2)*rnd.Int63n(64))
+				case r < 94:
+					// 写入失败的操作不生效，数据库可以继续使用
+					op := randomCrashOp(rnd, model)
+					fs.InjectWriteFault(rnd.Intn(3)+1, rnd.Intn(2) == 0)
+					err := op.run(db)
+					fs.ClearFaults()
+					if err == nil {
+						model.apply(op.fn)
+						if op.sync {
+							model.durable()
+						}
+						break
+					}
+					assert.Equal(t, fio.ErrInjectedFault, err, op.name)
+					if rnd.Intn(2) == 0 {
+						db = crashAndRecover(t, fs, opts, model, model.states, 0)
+					}
+				default:
+					// 持久化失败的操作在崩溃之后可能生效，也可能不生效
+					op := randomCrashOp(rnd, model)
+					fs.InjectSyncFault(1)
+					err := op.run(db)
+					fs.ClearFaults()
+					if err == nil {
+						model.apply(op.fn)
+						if op.sync {
+							model.durable()
+						}
+						break
+					}
+					assert.Equal(t, fio.ErrInjectedFault, err, op.name)
+					candidates := append(model.states, model.next(op.fn))
+					db = crashAndRecover(t, fs, opts, model, candidates, 0)
+				}
+				assert.Equal(t, model.current(), crashDBState(t, db), "op %d", i)
+			}
+			assert.Nil(t, db.Close())
+		})
+	}
+}
@@ -18,6 +18,7 @@ const (
 	HintFileName          = "hint-index"
 	MergeFinishedFileName = "merge-finished"
 	SeqNoFileName         = "seq-no"
+	OptionsFileName       = "options"
 )
 
 // DataFile 数据文件
@@ -28,36 +29,42 @@ type DataFile struct {
 }
 
 // OpenDataFile 打开新的数据文件
-func OpenDataFile(dirPath string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
+func OpenDataFile(fs fio.VFS, dirPath string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
 	fileName := GetDataFileName(dirPath, fileId)
-	return newDataFile(fileName, fileId, ioType)
+	return newDataFile(fs, fileName, fileId, ioType)
 }
 
 // OpenHintFile 打开 Hint 索引文件
-func OpenHintFile(dirPath string) (*DataFile, error) {
+func OpenHintFile(fs fio.VFS, dirPath string) (*DataFile, error) {
 	fileName := filepath.Join(dirPath, HintFileName)
-	return newDataFile(fileName, 0, fio.StandardFIO)
+	return newDataFile(fs, fileName, 0, fio.StandardFIO)
 }
 
 // OpenMergeFinishedFile 打开标识 merge 完成的文件
-func OpenMergeFinishedFile(dirPath string) (*DataFile, error) {
+func OpenMergeFinishedFile(fs fio.VFS, dirPath string) (*DataFile, error) {
 	fileName := filepath.Join(dirPath, MergeFinishedFileName)
-	return newDataFile(fileName, 0, fio.StandardFIO)
+	return newDataFile(fs, fileName, 0, fio.StandardFIO)
 }
 
 // OpenSeqNoFile 存储事务序列号的文件
-func OpenSeqNoFile(dirPath string) (*DataFile, error) {
+func OpenSeqNoFile(fs fio.VFS, dirPath string) (*DataFile, error) {
 	fileName := filepath.Join(dirPath, SeqNoFileName)
-	return newDataFile(fileName, 0, fio.StandardFIO)
+	return newDataFile(fs, fileName, 0, fio.StandardFIO)
+}
+
+// OpenOptionsFile 记录数据目录配置的文件，例如 key 的比较器
+func OpenOptionsFile(fs fio.VFS, dirPath string) (*DataFile, error) {
+	fileName := filepath.Join(dirPath, OptionsFileName)
+	return newDataFile(fs, fileName, 0, fio.StandardFIO)
 }
 
 func GetDataFileName(dirPath string, fileId uint32) string {
 	return filepath.Join(dirPath, fmt.Sprintf("%09d", fileId)+DataFileNameSuffix)
 }
 
-func newDataFile(fileName string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
+func newDataFile(fs fio.VFS, fileName string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
 	// 初始化 IOManager 管理器接口
-	ioManager, err := fio.NewIOManager(fileName, ioType)
+	ioManager, err := fs.OpenFile(fileName, ioType)
 	if err != nil {
 		return nil, err
 	}
@@ -95,10 +102,19 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	if header.crc == 0 && header.keySize == 0 && header.valueSize == 0 {
 		return nil, 0, io.EOF
 	}
+	// header 中的长度字段已经损坏
+	if headerSize < 0 {
+		return nil, 0, ErrInvalidCRC
+	}
 
 	// 取出对应的 key 和 value 的长度
 	keySize, valueSize := int64(header.keySize), int64(header.valueSize)
 	var recordSize = headerSize + keySize + valueSize
+	// 记录超出了文件末尾，说明数据没有写完整，和读取到文件末尾的处理一致
+	// 提前判断可以避免按照损坏的 header 分配过大的内存
+	if offset+recordSize > fileSize {
+		return nil, 0, io.EOF
+	}
 
 	logRecord := &LogRecord{Type: header.recordType}
 	// 开始读取用户实际存储的 key/value 数据
@@ -112,17 +128,50 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 		logRecord.Value = kvBuf[keySize:]
 	}
 
-	// 校验数据的有效性
+	// 校验数据的有效性，校验失败时仍然返回解码出的数据和长度，便于检查工具展示
 	crc := getLogRecordCRC(logRecord, headerBuf[crc32.Size:headerSize])
 	if crc != header.crc {
-		return nil, 0, ErrInvalidCRC
+		return logRecord, recordSize, ErrInvalidCRC
 	}
 	return logRecord, recordSize, nil
 }
 
+// IsTornTail 判断 offset 处读取失败的记录是否是崩溃时没有写完整的最后一条记录，size 为读取时返回的记录长度
+// 预分配的空间都是 0，没有写完整的记录之后的数据应该全部为 0
+func (df *DataFile) IsTornTail(offset, size int64) (bool, error) {
+	fileSize, err := df.IoManager.Size()
+	if err != nil {
+		return false, err
+	}
+	// header 损坏时不知道记录的长度，header 之后的数据也需要全部为 0
+	end := offset + size
+	if end < offset+maxLogRecordHeaderSize {
+		end = offset + maxLogRecordHeaderSize
+	}
+	buf := make([]byte, 4096)
+	for ; end < fileSize; end += int64(len(buf)) {
+		if fileSize-end < int64(len(buf)) {
+			buf = buf[:fileSize-end]
+		}
+		if _, err := df.IoManager.Read(buf, end); err != nil && err != io.EOF {
+			return false, err
+		}
+		for _, b := range buf {
+			if b != 0 {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
 func (df *DataFile) Write(buf []byte) error {
 	n, err := df.IoManager.Write(buf)
 	if err != nil {
+		// 丢弃没有写完整的部分，保证之后的数据紧接着已有的数据写入
+		if n > 0 {
+			_ = df.IoManager.Truncate(df.WriteOff)
+		}
 		return err
 	}
 	df.WriteOff += int64(n)
@@ -147,11 +196,11 @@ func (df *DataFile) Close() error {
 	return df.IoManager.Close()
 }
 
-func (df *DataFile) SetIOManager(dirPath string, ioType fio.FileIOType) error {
+func (df *DataFile) SetIOManager(fs fio.VFS, dirPath string, ioType fio.FileIOType) error {
 	if err := df.IoManager.Close(); err != nil {
 		return err
 	}
-	ioManager, err := fio.NewIOManager(GetDataFileName(dirPath, df.FileId), ioType)
+	ioManager, err := fs.OpenFile(GetDataFileName(dirPath, df.FileId), ioType)
 	if err != nil {
 		return err
 	}
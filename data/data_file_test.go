@@ -2,27 +2,30 @@ package data
 
 import (
 	"bitcask-go/fio"
+	"encoding/binary"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"math"
 	"os"
 	"testing"
 )
 
 func TestOpenDataFile(t *testing.T) {
-	dataFile1, err := OpenDataFile(os.TempDir(), 0, fio.StandardFIO)
+	dataFile1, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 0, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile1)
 
-	dataFile2, err := OpenDataFile(os.TempDir(), 111, fio.StandardFIO)
+	dataFile2, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 111, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile2)
 
-	dataFile3, err := OpenDataFile(os.TempDir(), 111, fio.StandardFIO)
+	dataFile3, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 111, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile3)
 }
 
 func TestDataFile_Write(t *testing.T) {
-	dataFile, err := OpenDataFile(os.TempDir(), 0, fio.StandardFIO)
+	dataFile, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 0, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
@@ -37,7 +40,7 @@ func TestDataFile_Write(t *testing.T) {
 }
 
 func TestDataFile_Close(t *testing.T) {
-	dataFile, err := OpenDataFile(os.TempDir(), 123, fio.StandardFIO)
+	dataFile, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 123, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
@@ -49,7 +52,7 @@ func TestDataFile_Close(t *testing.T) {
 }
 
 func TestDataFile_Sync(t *testing.T) {
-	dataFile, err := OpenDataFile(os.TempDir(), 456, fio.StandardFIO)
+	dataFile, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 456, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
@@ -61,7 +64,7 @@ func TestDataFile_Sync(t *testing.T) {
 }
 
 func TestDataFile_ReadLogRecord(t *testing.T) {
-	dataFile, err := OpenDataFile(os.TempDir(), 6666, fio.StandardFIO)
+	dataFile, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 6666, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, dataFile)
 
@@ -109,3 +112,32 @@ func TestDataFile_ReadLogRecord(t *testing.T) {
 	assert.Equal(t, rec3, readRec3)
 	assert.Equal(t, size3, readSize3)
 }
+
+func TestDataFile_ReadLogRecord_CorruptedHeader(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-corrupted-header")
+	defer os.RemoveAll(dir)
+	dataFile, err := OpenDataFile(fio.OSFS{}, dir, 0, fio.StandardFIO)
+	assert.Nil(t, err)
+	defer dataFile.Close()
+
+	// header 中的 value size 为负数
+	header := make([]byte, maxLogRecordHeaderSize)
+	header[0] = 1
+	index := 5
+	index += binary.PutVarint(header[index:], 4)
+	index += binary.PutVarint(header[index:], -100)
+	err = dataFile.Write(append(header[:index], []byte("name")...))
+	assert.Nil(t, err)
+	offset := dataFile.WriteOff
+	_, _, err = dataFile.ReadLogRecord(0)
+	assert.Equal(t, ErrInvalidCRC, err)
+
+	// header 中的 key size 超过了文件的大小，不会按照它分配内存
+	index = 5
+	index += binary.PutVarint(header[index:], math.MaxUint32)
+	index += binary.PutVarint(header[index:], 0)
+	err = dataFile.Write(header[:index])
+	assert.Nil(t, err)
+	_, _, err = dataFile.ReadLogRecord(offset)
+	assert.Equal(t, io.EOF, err)
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"encoding/binary"
 	"hash/crc32"
+	"math"
 )
 
 type LogRecordType = byte
@@ -11,6 +12,8 @@ const (
 	LogRecordNormal LogRecordType = iota
 	LogRecordDeleted
 	LogRecordTxnFinished
+	LogRecordVersioned      // 带有版本信息的数据，value 的开头是序列号和写入时间
+	LogRecordVersionDeleted // 带有版本信息的删除标记
 )
 
 // crc type keySize valueSize
@@ -101,7 +104,43 @@ func DecodeLogRecordPos(buf []byte) *LogRecordPos {
 	return &LogRecordPos{Fid: uint32(fileId), Offset: offset, Size: uint32(size)}
 }
 
+// EncodeVersionedValue 在 value 的前面加上版本的序列号和写入时间（纳秒）
+//
+//	+-------------+-------------+-------------+
+//	|    seq no   |  timestamp  |    value    |
+//	+-------------+-------------+-------------+
+//	 变长（最大10）  变长（最大10）     变长
+func EncodeVersionedValue(seqNo uint64, timestamp int64, value []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64*2+len(value))
+	var index = 0
+	index += binary.PutUvarint(buf[index:], seqNo)
+	index += binary.PutVarint(buf[index:], timestamp)
+	index += copy(buf[index:], value)
+	return buf[:index]
+}
+
+// DecodeVersionedValue 解码带有版本信息的 value，返回序列号、写入时间和实际的 value
+func DecodeVersionedValue(buf []byte) (uint64, int64, []byte) {
+	var index = 0
+	seqNo, n := binary.Uvarint(buf[index:])
+	index += n
+	timestamp, n := binary.Varint(buf[index:])
+	index += n
+	return seqNo, timestamp, buf[index:]
+}
+
+// IsDeletedType 记录的类型是否是删除标记
+func IsDeletedType(typ LogRecordType) bool {
+	return typ == LogRecordDeleted || typ == LogRecordVersionDeleted
+}
+
+// MaxEncodedLogRecordSize 返回指定长度的 key 和 value 编码之后的最大长度
+func MaxEncodedLogRecordSize(keySize, valueSize int) int64 {
+	return maxLogRecordHeaderSize + int64(keySize) + int64(valueSize)
+}
+
 // 对字节数组中的 Header 信息进行解码
+// 长度字段不完整时返回 nil，长度字段无效（溢出、为负数或者超过 uint32）时返回 -1
 func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 	if len(buf) <= 4 {
 		return nil, 0
@@ -115,11 +154,23 @@ func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 	var index = 5
 	// 取出实际的 key size
 	keySize, n := binary.Varint(buf[index:])
+	if n == 0 {
+		return nil, 0
+	}
+	if n < 0 || keySize < 0 || keySize > math.MaxUint32 {
+		return header, -1
+	}
 	header.keySize = uint32(keySize)
 	index += n
 
 	// 取出实际的 value size
 	valueSize, n := binary.Varint(buf[index:])
+	if n == 0 {
+		return nil, 0
+	}
+	if n < 0 || valueSize < 0 || valueSize > math.MaxUint32 {
+		return header, -1
+	}
 	header.valueSize = uint32(valueSize)
 	index += n
 
@@ -93,3 +93,17 @@ func TestGetLogRecordCRC(t *testing.T) {
 	crc3 := getLogRecordCRC(rec3, headerBuf3[crc32.Size:])
 	assert.Equal(t, uint32(290887979), crc3)
 }
+
+func TestEncodeVersionedValue(t *testing.T) {
+	buf := EncodeVersionedValue(42, 1700000000000000000, []byte("bitcask-go"))
+	seqNo, timestamp, value := DecodeVersionedValue(buf)
+	assert.Equal(t, uint64(42), seqNo)
+	assert.Equal(t, int64(1700000000000000000), timestamp)
+	assert.Equal(t, []byte("bitcask-go"), value)
+
+	// 删除标记只有版本信息
+	seqNo, timestamp, value = DecodeVersionedValue(EncodeVersionedValue(1, 0, nil))
+	assert.Equal(t, uint64(1), seqNo)
+	assert.Equal(t, int64(0), timestamp)
+	assert.Equal(t, 0, len(value))
+}
@@ -4,76 +4,114 @@ import (
 	"bitcask-go/data"
 	"bitcask-go/fio"
 	"bitcask-go/index"
-	"bitcask-go/utils"
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"github.com/gofrs/flock"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
-	seqNoKey     = "seq.no"
-	fileLockName = "flock"
+	seqNoKey      = "seq.no"
+	comparatorKey = "comparator"
+	fileLockName  = "flock"
 )
 
 // DB bitcask 存储引擎实例
 type DB struct {
-	options         Options
-	mu              *sync.RWMutex
-	fileIds         []int                     // 文件 id，只能在加载索引的时候使用，不能在其他的地方更新和使用
-	activeFile      *data.DataFile            // 当前活跃数据文件，可以用于写入
-	olderFiles      map[uint32]*data.DataFile // 旧的数据文件，只能用于读
-	index           index.Indexer             // 内存索引
-	seqNo           uint64                    // 事务序列号，全局递增
-	isMerging       bool                      // 是否正在 merge
-	seqNoFileExists bool                      // 存储事务序列号的文件是否存在
-	isInitial       bool                      // 是否是第一次初始化此数据目录
-	fileLock        *flock.Flock              // 文件锁保证多进程之间的互斥
-	bytesWrite      uint                      // 累计写了多少个字节
-	reclaimSize     int64                     // 表示有多少数据是无效的
+	options      Options
+	mu           *sync.RWMutex
+	fileIds      []int                     // 文件 id，只能在加载索引的时候使用，不能在其他的地方更新和使用
+	activeFile   *data.DataFile            // 当前活跃数据文件，可以用于写入
+	olderFiles   map[uint32]*data.DataFile // 旧的数据文件，只能用于读
+	index        index.Indexer             // 内存索引
+	seqNo        uint64                    // 事务序列号，全局递增
+	isMerging    bool                      // 是否正在 merge
+	isInitial    bool                      // 是否是第一次初始化此数据目录
+	fileLock     io.Closer                 // 文件锁保证多进程之间的互斥
+	bytesWrite   uint                      // 累计写了多少个字节
+	reclaimSize  int64                     // 表示有多少数据是无效的
+	recovery     RecoveryInfo              // 打开数据库时的恢复信息，只在 Open 中使用
+	diskFull     atomic.Bool               // 磁盘剩余空间是否低于阈值，为 true 时拒绝写入
+	closeCh      chan struct{}             // 关闭时通知后台任务退出
+	closeOnce    sync.Once                 // 保证 closeCh 只关闭一次
+	bgWg         sync.WaitGroup            // 等待后台任务退出
+	lastSyncTime time.Time                 // 最近一次持久化活跃文件的时间
+	preallocOff  int64                     // 活跃文件已经预分配到的位置
+	versions     map[string][]*keyVersion  // 开启多版本时每个 key 保留的版本，按照序列号从小到大排列
 }
 
 // Stat 存储引擎统计信息
 type Stat struct {
-	KeyNum          uint  // key 的总数量
-	DataFileNum     uint  // 数据文件的数量
-	ReclaimableSize int64 // 可以进行 merge 回收的数据量，字节为单位
-	DiskSize        int64 // 数据目录所占磁盘空间大小
+	KeyNum          uint      // key 的总数量
+	DataFileNum     uint      // 数据文件的数量
+	ReclaimableSize int64     // 可以进行 merge 回收的数据量，字节为单位
+	DiskSize        int64     // 数据目录所占磁盘空间大小
+	DiskFull        bool      // 磁盘剩余空间是否低于阈值，为 true 时数据库只读
+	LastSyncTime    time.Time // 最近一次持久化活跃文件的时间，没有持久化过时为零值
 }
 
 // Open 打开 bitcask 存储引擎实例
-func Open(options Options) (*DB, error) {
+func Open(options Options) (_ *DB, err error) {
 	// 对用户传入的配置项进行校验
 	if err := checkOptions(options); err != nil {
 		return nil, err
 	}
+	if options.Metrics == nil {
+		options.Metrics = nopMetrics{}
+	}
+	if options.EventListener == nil {
+		options.EventListener = NopEventListener{}
+	}
+	if options.FS == nil {
+		options.FS = fio.OSFS{}
+	}
+	startTime := time.Now()
 
 	var isInitial bool
 	// 判断数据目录是否存在，如果不存在的话，则创建这个目录
-	if _, err := os.Stat(options.DirPath); os.IsNotExist(err) {
+	if _, err := options.FS.Stat(options.DirPath); os.IsNotExist(err) {
 		isInitial = true
-		if err := os.MkdirAll(options.DirPath, os.ModePerm); err != nil {
+		if err := options.FS.MkdirAll(options.DirPath); err != nil {
 			return nil, err
 		}
 	}
 
 	// 判断当前数据目录是否正在使用
-	fileLock := flock.New(filepath.Join(options.DirPath, fileLockName))
-	hold, err := fileLock.TryLock()
+	fileLock, err := options.FS.Lock(filepath.Join(options.DirPath, fileLockName))
+	if err == fio.ErrFileLocked {
+		return nil, ErrDatabaseIsUsing
+	}
 	if err != nil {
 		return nil, err
 	}
-	if !hold {
-		return nil, ErrDatabaseIsUsing
-	}
+	// 打开失败时释放文件锁、索引和已经打开的数据文件，之后可以重新打开
+	var db *DB
+	defer func() {
+		if err == nil {
+			return
+		}
+		if db != nil {
+			if db.activeFile != nil {
+				_ = db.activeFile.Close()
+			}
+			for _, file := range db.olderFiles {
+				_ = file.Close()
+			}
+			_ = db.index.Close()
+		}
+		_ = fileLock.Close()
+	}()
 
-	entries, err := os.ReadDir(options.DirPath)
+	entries, err := options.FS.ReadDir(options.DirPath)
 	if err != nil {
 		return nil, err
 	}
@@ -82,13 +120,20 @@ func Open(options Options) (*DB, error) {
 	}
 
 	// 初始化 DB 实例结构体
-	db := &DB{
+	db = &DB{
 		options:    options,
 		mu:         new(sync.RWMutex),
 		olderFiles: make(map[uint32]*data.DataFile),
-		index:      index.NewIndexer(options.IndexType, options.DirPath, options.SyncWrites),
+		index:      index.NewIndexer(options.IndexType, options.DirPath, options.SyncWrites, options.Comparator, options.BPlusTreeAsyncBatchSize),
 		isInitial:  isInitial,
 		fileLock:   fileLock,
+		closeCh:    make(chan struct{}),
+		versions:   make(map[string][]*keyVersion),
+	}
+
+	// 检查数据目录记录的比较器，不一致时之后可以使用正确的比较器重新打开
+	if err := db.checkComparator(); err != nil {
+		return nil, err
 	}
 
 	// 加载 merge 数据目录
@@ -103,9 +148,11 @@ func Open(options Options) (*DB, error) {
 
 	// B+树索引不需要从数据文件中加载索引
 	if options.IndexType != BPlusTree {
-		// 从 hint 索引文件中加载索引
-		if err := db.loadIndexFromHintFile(); err != nil {
-			return nil, err
+		// 从 hint 索引文件中加载索引，hint 文件中只有最新的版本，开启多版本时从数据文件中加载
+		if !db.versioned() {
+			if err := db.loadIndexFromHintFile(); err != nil {
+				return nil, err
+			}
 		}
 
 		// 从数据文件中加载索引
@@ -114,35 +161,53 @@ func Open(options Options) (*DB, error) {
 		}
 	}
 
-	// 取出当前事务序列号
+	// B+ 树索引只需要重放最后一条已经应用的记录之后的数据
 	if options.IndexType == BPlusTree {
-		if err := db.loadSeqNo(); err != nil {
+		if err := db.loadIndexFromLogTail(); err != nil {
 			return nil, err
 		}
-		if db.activeFile != nil {
-			size, err := db.activeFile.IoManager.Size()
-			if err != nil {
-				return nil, err
-			}
-			db.activeFile.WriteOff = size
-		}
 	}
 
-	// 重置 IO 类型为标准文件 IO
-	if db.options.MMapAtStartup {
+	// 去掉活跃文件末尾预分配或者没有写完整的部分，保证新的数据紧接着已有的数据写入
+	if err := db.trimActiveFile(); err != nil {
+		return nil, err
+	}
+
+	// 重置 IO 类型为用户配置的 IO 类型
+	if db.options.MMapAtStartup && db.options.IOType != fio.MemoryMap {
 		if err := db.resetIoType(); err != nil {
 			return nil, err
 		}
 	}
 
+	db.recovery.DataFileNum = len(db.fileIds)
+	db.recovery.Duration = time.Since(startTime)
+	db.options.EventListener.OnRecovery(db.recovery)
+
+	// 启动后台任务定期检查磁盘剩余空间
+	if db.options.MinFreeDiskBytes > 0 {
+		db.checkDiskSpace()
+		db.bgWg.Add(1)
+		go db.diskSpaceLoop()
+	}
+	// 启动后台任务定期持久化活跃文件
+	if db.options.SyncInterval > 0 {
+		db.bgWg.Add(1)
+		go db.syncLoop()
+	}
+
 	return db, nil
 }
 
 // Close 关闭数据库
-func (db *DB) Close() error {
+func (db *DB) Close() (err error) {
+	defer func() {
+		db.options.EventListener.OnClose(CloseInfo{SeqNo: db.seqNo, Err: err})
+	}()
+	db.stopBackgroundTasks()
 	defer func() {
 		// 释放文件锁
-		if err := db.fileLock.Unlock(); err != nil {
+		if err := db.fileLock.Close(); err != nil {
 			panic(fmt.Sprintf("failed to unlock the directory, %v", err))
 		}
 		// 关闭索引
@@ -157,7 +222,7 @@ func (db *DB) Close() error {
 	defer db.mu.Unlock()
 
 	// 保存当前事务序列号
-	seqNoFile, err := data.OpenSeqNoFile(db.options.DirPath)
+	seqNoFile, err := data.OpenSeqNoFile(db.options.FS, db.options.DirPath)
 	if err != nil {
 		return err
 	}
@@ -173,6 +238,13 @@ func (db *DB) Close() error {
 		return err
 	}
 
+	// 去掉活跃文件预分配的部分，并保证关闭之前写入的数据全部持久化
+	if err := db.trimActiveFile(); err != nil {
+		return err
+	}
+	if err := db.syncActiveFile(); err != nil {
+		return err
+	}
 	//	关闭当前活跃文件
 	if err := db.activeFile.Close(); err != nil {
 		return err
@@ -193,20 +265,21 @@ func (db *DB) Sync() error {
 	}
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	return db.activeFile.Sync()
+	return db.syncActiveFile()
 }
 
 // Stat 返回数据库的相关统计信息
 func (db *DB) Stat() *Stat {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.expireVersions(time.Now())
 
 	var dataFiles = uint(len(db.olderFiles))
 	if db.activeFile != nil {
 		dataFiles += 1
 	}
 
-	dirSize, err := utils.DirSize(db.options.DirPath)
+	dirSize, err := fio.DirSize(db.options.FS, db.options.DirPath)
 	if err != nil {
 		panic(fmt.Sprintf("failed to get dir size : %v", err))
 	}
@@ -215,6 +288,8 @@ func (db *DB) Stat() *Stat {
 		DataFileNum:     dataFiles,
 		ReclaimableSize: db.reclaimSize,
 		DiskSize:        dirSize,
+		DiskFull:        db.diskFull.Load(),
+		LastSyncTime:    db.lastSyncTime,
 	}
 }
 
@@ -222,15 +297,24 @@ func (db *DB) Stat() *Stat {
 func (db *DB) Backup(dir string) error {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
-	return utils.CopyDir(db.options.DirPath, dir, []string{fileLockName})
+	return fio.CopyDir(db.options.FS, db.options.DirPath, dir, []string{fileLockName})
 }
 
 // Put 写入 Key/Value 数据，key 不能为空
 func (db *DB) Put(key []byte, value []byte) error {
+	return db.PutWithOptions(key, value, DefaultWriteOptions)
+}
+
+// PutWithOptions 按照指定的写配置写入 Key/Value 数据
+func (db *DB) PutWithOptions(key []byte, value []byte, opts WriteOptions) error {
 	// 判断 key 是否有效
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
+	if err := db.checkKeyValueSize(key, value); err != nil {
+		return err
+	}
+	defer db.observeOp(MetricPutTotal, MetricPutDuration, time.Now())
 
 	// 构造 LogRecord 结构体
 	logRecord := &data.LogRecord{
@@ -239,14 +323,24 @@ func (db *DB) Put(key []byte, value []byte) error {
 		Type:  data.LogRecordNormal,
 	}
 
-	// 追加写入到当前活跃数据文件当中
-	pos, err := db.appendLogRecordWithLock(logRecord)
+	// 追加写入到当前活跃数据文件当中，持有锁更新索引，保证索引按照写入的顺序更新
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var version *keyVersion
+	if db.versioned() {
+		version = withVersion(logRecord, atomic.AddUint64(&db.seqNo, 1), time.Now().UnixNano())
+	}
+	pos, err := db.appendLogRecord(logRecord, opts)
 	if err != nil {
 		return err
 	}
 
-	// 更新内存索引
-	if oldPos := db.index.Put(key, pos); oldPos != nil {
+	// 更新内存索引，开启多版本时旧的版本按照保留策略清理之后才可以回收
+	oldPos := db.index.Put(key, pos)
+	if version != nil {
+		version.pos = pos
+		db.addVersion(key, version)
+	} else if oldPos != nil {
 		db.reclaimSize += int64(oldPos.Size)
 	}
 
@@ -255,10 +349,19 @@ func (db *DB) Put(key []byte, value []byte) error {
 
 // Delete 根据 key 删除对应的数据
 func (db *DB) Delete(key []byte) error {
+	return db.DeleteWithOptions(key, DefaultWriteOptions)
+}
+
+// DeleteWithOptions 按照指定的写配置删除数据
+func (db *DB) DeleteWithOptions(key []byte, opts WriteOptions) error {
 	// 判断 key 的有效性
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
+	if err := db.checkKeyValueSize(key, nil); err != nil {
+		return err
+	}
+	defer db.observeOp(MetricDeleteTotal, MetricDeleteDuration, time.Now())
 
 	// 先检查 key 是否存在，如果不存在的话直接返回
 	if pos := db.index.Get(key); pos == nil {
@@ -271,17 +374,28 @@ func (db *DB) Delete(key []byte) error {
 		Type: data.LogRecordDeleted,
 	}
 	// 写入到数据文件当中
-	pos, err := db.appendLogRecordWithLock(logRecord)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var version *keyVersion
+	if db.versioned() {
+		version = withVersion(logRecord, atomic.AddUint64(&db.seqNo, 1), time.Now().UnixNano())
+	}
+	pos, err := db.appendLogRecord(logRecord, opts)
 	if err != nil {
 		return err
 	}
-	db.reclaimSize += int64(pos.Size)
 
 	//	从内存索引中将对应的 key 删除
 	oldPos, ok := db.index.Delete(key)
 	if !ok {
 		return ErrIndexUpdateFailed
 	}
+	if version != nil {
+		version.pos = pos
+		db.addVersion(key, version)
+		return nil
+	}
+	db.reclaimSize += int64(pos.Size)
 	if oldPos != nil {
 		db.reclaimSize += int64(oldPos.Size)
 	}
@@ -297,6 +411,7 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 	if len(key) == 0 {
 		return nil, ErrKeyIsEmpty
 	}
+	defer db.observeOp(MetricGetTotal, MetricGetDuration, time.Now())
 
 	// 从内存数据结构中取出 key 对应的索引信息
 	logRecordPos := db.index.Get(key)
@@ -311,13 +426,12 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 
 // ListKeys 获取数据库中所有的 key
 func (db *DB) ListKeys() [][]byte {
+	// 先获取数量再创建迭代器，B+ 树索引的迭代器持有读事务时不能再提交索引更新
+	keys := make([][]byte, 0, db.index.Size())
 	iterator := db.index.Iterator(false)
 	defer iterator.Close()
-	keys := make([][]byte, db.index.Size())
-	var idx int
 	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
-		keys[idx] = iterator.Key()
-		idx++
+		keys = append(keys, iterator.Key())
 	}
 	return keys
 }
@@ -356,26 +470,48 @@ func (db *DB) getValueByPosition(logRecordPos *data.LogRecordPos) ([]byte, error
 	}
 
 	// 根据偏移读取对应的数据
-	logRecord, _, err := dataFile.ReadLogRecord(logRecordPos.Offset)
+	logRecord, size, err := dataFile.ReadLogRecord(logRecordPos.Offset)
 	if err != nil {
 		return nil, err
 	}
+	db.options.Metrics.IncCounter(MetricBytesRead, uint64(size))
 
-	if logRecord.Type == data.LogRecordDeleted {
+	switch logRecord.Type {
+	case data.LogRecordDeleted, data.LogRecordVersionDeleted:
 		return nil, ErrKeyNotFound
+	case data.LogRecordVersioned:
+		_, _, value := data.DecodeVersionedValue(logRecord.Value)
+		return value, nil
 	}
 
 	return logRecord.Value, nil
 }
 
-func (db *DB) appendLogRecordWithLock(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
+func (db *DB) appendLogRecordWithLock(logRecord *data.LogRecord, opts WriteOptions) (*data.LogRecordPos, error) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	return db.appendLogRecord(logRecord)
+	return db.appendLogRecord(logRecord, opts)
+}
+
+// 追加写入数据，并根据配置决定是否持久化
+func (db *DB) appendLogRecord(logRecord *data.LogRecord, opts WriteOptions) (*data.LogRecordPos, error) {
+	pos, err := db.writeLogRecord(logRecord)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.syncIfNeeded(opts.Sync); err != nil {
+		return nil, err
+	}
+	return pos, nil
 }
 
-// 追加写数据到活跃文件中
-func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
+// 追加写入数据到活跃文件中，不进行持久化
+func (db *DB) writeLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
+	// 磁盘剩余空间不足时直接拒绝写入，避免写入不完整的数据
+	if db.diskFull.Load() {
+		return nil, ErrDiskFull
+	}
+
 	// 判断当前活跃数据文件是否存在，因为数据库在没有写入的时候是没有文件生成的
 	// 如果为空则初始化数据文件
 	if db.activeFile == nil {
@@ -388,44 +524,76 @@ func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, er
 	encRecord, size := data.EncodeLogRecord(logRecord)
 	// 如果写入的数据已经到达了活跃文件的阈值，则关闭活跃文件，并打开新的文件
 	if db.activeFile.WriteOff+size > db.options.DataFileSize {
-		// 先持久化数据文件，保证已有的数据持久到磁盘当中
-		if err := db.activeFile.Sync(); err != nil {
+		// 打开新的文件之前检查磁盘剩余空间
+		if !db.checkDiskSpace() {
+			return nil, ErrDiskFull
+		}
+
+		// 去掉预分配的部分，再持久化数据文件，保证已有的数据持久到磁盘当中
+		if err := db.trimActiveFile(); err != nil {
+			return nil, err
+		}
+		if err := db.syncActiveFile(); err != nil {
 			return nil, err
 		}
 
 		// 当前活跃文件转换为旧的数据文件
-		db.olderFiles[db.activeFile.FileId] = db.activeFile
+		oldFile := db.activeFile
+		db.olderFiles[oldFile.FileId] = oldFile
 
 		// 打开新的数据文件
 		if err := db.setActiveDataFile(); err != nil {
 			return nil, err
 		}
+		db.options.Metrics.IncCounter(MetricFileRotations, 1)
+		db.options.EventListener.OnFileRotated(FileRotationInfo{
+			OldFileId:   oldFile.FileId,
+			NewFileId:   db.activeFile.FileId,
+			OldFileSize: oldFile.WriteOff,
+		})
 	}
 
 	writeOff := db.activeFile.WriteOff
+	if err := db.preallocateActiveFile(writeOff + size); err != nil {
+		return nil, err
+	}
 	if err := db.activeFile.Write(encRecord); err != nil {
 		return nil, err
 	}
 
 	db.bytesWrite += uint(size)
-	// 根据用户配置决定是否持久化
-	var needSync = db.options.SyncWrites
+	db.options.Metrics.IncCounter(MetricBytesWritten, uint64(size))
+
+	// 构造内存索引信息
+	pos := &data.LogRecordPos{Fid: db.activeFile.FileId, Offset: writeOff, Size: uint32(size)}
+	return pos, nil
+}
+
+// 根据用户配置决定是否持久化，sync 为 true 时总是持久化
+// 切换活跃文件时旧文件已经持久化，所以持久化活跃文件即可保证之前写入的数据全部持久化
+func (db *DB) syncIfNeeded(sync bool) error {
+	var needSync = sync || db.options.SyncWrites
 	if !needSync && db.options.BytesPerSync > 0 && db.bytesWrite >= db.options.BytesPerSync {
 		needSync = true
 	}
 	if needSync {
-		if err := db.activeFile.Sync(); err != nil {
-			return nil, err
-		}
-		// 清空累计值
-		if db.bytesWrite > 0 {
-			db.bytesWrite = 0
-		}
+		return db.syncActiveFile()
 	}
+	return nil
+}
 
-	// 构造内存索引信息
-	pos := &data.LogRecordPos{Fid: db.activeFile.FileId, Offset: writeOff, Size: uint32(size)}
-	return pos, nil
+// 持久化当前活跃文件，并清空累计写入的字节数
+// 在访问此方法前必须持有互斥锁
+func (db *DB) syncActiveFile() error {
+	start := time.Now()
+	if err := db.activeFile.Sync(); err != nil {
+		db.options.EventListener.OnSyncError(SyncErrorInfo{FileId: db.activeFile.FileId, Err: err})
+		return err
+	}
+	db.observeOp(MetricFsyncTotal, MetricFsyncDuration, start)
+	db.bytesWrite = 0
+	db.lastSyncTime = time.Now()
+	return nil
 }
 
 // 设置当前活跃文件
@@ -436,17 +604,40 @@ func (db *DB) setActiveDataFile() error {
 		initialFileId = db.activeFile.FileId + 1
 	}
 	// 打开新的数据文件
-	dataFile, err := data.OpenDataFile(db.options.DirPath, initialFileId, fio.StandardFIO)
+	dataFile, err := data.OpenDataFile(db.options.FS, db.options.DirPath, initialFileId, db.options.IOType)
 	if err != nil {
 		return err
 	}
 	db.activeFile = dataFile
+	db.preallocOff = 0
+	return db.preallocateActiveFile(1)
+}
+
+// 按照 PreallocateSize 预分配活跃文件，保证 end 之前的空间已经分配
+// IOManager 不支持预分配时不做任何处理
+func (db *DB) preallocateActiveFile(end int64) error {
+	chunk := db.options.PreallocateSize
+	if chunk <= 0 || end <= db.preallocOff {
+		return nil
+	}
+	preallocator, ok := db.activeFile.IoManager.(fio.Preallocator)
+	if !ok {
+		return nil
+	}
+	size := (end + chunk - 1) / chunk * chunk
+	if size > db.options.DataFileSize && end <= db.options.DataFileSize {
+		size = db.options.DataFileSize
+	}
+	if err := preallocator.Preallocate(size); err != nil {
+		return err
+	}
+	db.preallocOff = size
 	return nil
 }
 
 // 从磁盘中加载数据文件
 func (db *DB) loadDataFiles() error {
-	dirEntries, err := os.ReadDir(db.options.DirPath)
+	dirEntries, err := db.options.FS.ReadDir(db.options.DirPath)
 	if err != nil {
 		return err
 	}
@@ -471,11 +662,11 @@ func (db *DB) loadDataFiles() error {
 
 	// 遍历每个文件id，打开对应的数据文件
 	for i, fid := range fileIds {
-		ioType := fio.StandardFIO
+		ioType := db.options.IOType
 		if db.options.MMapAtStartup {
 			ioType = fio.MemoryMap
 		}
-		dataFile, err := data.OpenDataFile(db.options.DirPath, uint32(fid), ioType)
+		dataFile, err := data.OpenDataFile(db.options.FS, db.options.DirPath, uint32(fid), ioType)
 		if err != nil {
 			return err
 		}
@@ -491,6 +682,11 @@ func (db *DB) loadDataFiles() error {
 // 从数据文件中加载索引
 // 遍历文件中的所有记录，并更新到内存索引中
 func (db *DB) loadIndexFromDataFiles() error {
+	return db.loadIndexFromPosition(0, 0)
+}
+
+// 从 startFid 文件的 startOffset 位置开始遍历记录，更新到索引中
+func (db *DB) loadIndexFromPosition(startFid uint32, startOffset int64) error {
 	// 没有文件，说明数据库是空的，直接返回
 	if len(db.fileIds) == 0 {
 		return nil
@@ -499,7 +695,8 @@ func (db *DB) loadIndexFromDataFiles() error {
 	// 查看是否发生过 merge
 	hasMerge, nonMergeFileId := false, uint32(0)
 	mergeFinFileName := filepath.Join(db.options.DirPath, data.MergeFinishedFileName)
-	if _, err := os.Stat(mergeFinFileName); err == nil {
+	// 开启多版本时 hint 文件中没有旧的版本，需要从 merge 之后的数据文件中加载
+	if _, err := db.options.FS.Stat(mergeFinFileName); err == nil && !db.versioned() {
 		fid, err := db.getNonMergeFileId(db.options.DirPath)
 		if err != nil {
 			return err
@@ -508,14 +705,27 @@ func (db *DB) loadIndexFromDataFiles() error {
 		nonMergeFileId = fid
 	}
 
-	updateIndex := func(key []byte, typ data.LogRecordType, pos *data.LogRecordPos) {
+	var currentSeqNo = nonTransactionSeqNo
+	updateIndex := func(key []byte, logRecord *data.LogRecord, seqNo uint64, pos *data.LogRecordPos) {
+		// 带有版本信息的记录中有序列号，即使没有开启多版本也要保证之后的序列号递增
+		version := newKeyVersion(logRecord, seqNo, pos)
+		if version.seqNo > currentSeqNo {
+			currentSeqNo = version.seqNo
+		}
+
 		var oldPos *data.LogRecordPos
-		if typ == data.LogRecordDeleted {
+		if version.deleted {
 			oldPos, _ = db.index.Delete(key)
-			db.reclaimSize += int64(pos.Size)
 		} else {
 			oldPos = db.index.Put(key, pos)
 		}
+		if db.versioned() {
+			db.addVersion(key, version)
+			return
+		}
+		if version.deleted {
+			db.reclaimSize += int64(pos.Size)
+		}
 		if oldPos != nil {
 			db.reclaimSize += int64(oldPos.Size)
 		}
@@ -523,7 +733,6 @@ func (db *DB) loadIndexFromDataFiles() error {
 
 	// 暂存事务数据
 	transactionRecords := make(map[uint64][]*data.TransactionRecord)
-	var currentSeqNo = nonTransactionSeqNo
 
 	// 遍历所有的文件id，处理文件中的记录
 	for i, fid := range db.fileIds {
@@ -532,6 +741,10 @@ func (db *DB) loadIndexFromDataFiles() error {
 		if hasMerge && fileId < nonMergeFileId {
 			continue
 		}
+		// 已经应用到索引中的文件
+		if fileId < startFid {
+			continue
+		}
 		var dataFile *data.DataFile
 		if fileId == db.activeFile.FileId {
 			dataFile = db.activeFile
@@ -540,15 +753,29 @@ func (db *DB) loadIndexFromDataFiles() error {
 		}
 
 		var offset int64 = 0
+		if fileId == startFid {
+			offset = startOffset
+		}
 		for {
 			logRecord, size, err := dataFile.ReadLogRecord(offset)
 			if err != nil {
 				if err == io.EOF {
 					break
 				}
+				// 活跃文件末尾没有写完整的记录之后是预分配的 0，当作文件末尾处理，打开之后会被截断
+				if err == data.ErrInvalidCRC && i == len(db.fileIds)-1 {
+					torn, tornErr := dataFile.IsTornTail(offset, size)
+					if tornErr != nil {
+						return tornErr
+					}
+					if torn {
+						break
+					}
+				}
 				return err
 			}
 
+			db.recovery.DataRecords++
 			// 构造内存索引并保存
 			logRecordPos := &data.LogRecordPos{Fid: fileId, Offset: offset, Size: uint32(size)}
 
@@ -556,12 +783,12 @@ func (db *DB) loadIndexFromDataFiles() error {
 			realKey, seqNo := parseLogRecordKey(logRecord.Key)
 			if seqNo == nonTransactionSeqNo {
 				// 非事务操作，直接更新内存索引
-				updateIndex(realKey, logRecord.Type, logRecordPos)
+				updateIndex(realKey, logRecord, seqNo, logRecordPos)
 			} else {
 				// 事务完成，对应的 seq no 的数据可以更新到内存索引中
 				if logRecord.Type == data.LogRecordTxnFinished {
 					for _, txnRecord := range transactionRecords[seqNo] {
-						updateIndex(txnRecord.Record.Key, txnRecord.Record.Type, txnRecord.Pos)
+						updateIndex(txnRecord.Record.Key, txnRecord.Record, seqNo, txnRecord.Pos)
 					}
 					delete(transactionRecords, seqNo)
 				} else {
@@ -588,11 +815,46 @@ func (db *DB) loadIndexFromDataFiles() error {
 		}
 	}
 
+	// 没有完成标识的事务数据直接丢弃
+	db.recovery.UncommittedTxns = len(transactionRecords)
+	for _, records := range transactionRecords {
+		db.recovery.UncommittedRecords += len(records)
+	}
+
 	// 更新事务序列号
-	db.seqNo = currentSeqNo
+	if currentSeqNo > db.seqNo {
+		db.seqNo = currentSeqNo
+	}
 	return nil
 }
 
+// B+ 树索引文件中记录了最后一条已经应用的记录的位置和事务序列号
+// 打开时只需要重放这个位置之后的记录，没有记录位置时重放所有的数据文件
+func (db *DB) loadIndexFromLogTail() error {
+	// 兼容之前关闭时保存的事务序列号文件
+	if err := db.loadSeqNo(); err != nil {
+		return err
+	}
+
+	bpt := db.index.(*index.BPlusTree)
+	meta, ok := bpt.Meta()
+	if meta.SeqNo > db.seqNo {
+		db.seqNo = meta.SeqNo
+	}
+	var startFid uint32
+	var startOffset int64
+	if ok {
+		startFid, startOffset = meta.Applied.Fid, meta.Applied.Offset+int64(meta.Applied.Size)
+	}
+	if err := db.loadIndexFromPosition(startFid, startOffset); err != nil {
+		return err
+	}
+
+	// 保存重放之后的索引和事务序列号
+	bpt.SetSeqNo(db.seqNo)
+	return bpt.Flush()
+}
+
 func checkOptions(options Options) error {
 	if options.DirPath == "" {
 		return errors.New("database dir path is empty")
@@ -603,16 +865,68 @@ func checkOptions(options Options) error {
 	if options.DataFileMergeRatio < 0 || options.DataFileMergeRatio > 1 {
 		return errors.New("invalid merge ratio, must between 0 and 1")
 	}
+	if options.MinFreeDiskBytes > 0 && options.DiskCheckInterval <= 0 {
+		return errors.New("disk check interval must be greater than 0")
+	}
+	if options.IOType > fio.DSyncIO {
+		return errors.New("unsupported io type")
+	}
+	if options.SyncInterval < 0 {
+		return errors.New("sync interval must not be negative")
+	}
+	if options.PreallocateSize < 0 {
+		return errors.New("preallocate size must not be negative")
+	}
+	if options.BPlusTreeAsyncBatchSize < 0 {
+		return errors.New("bptree async batch size must not be negative")
+	}
+	if options.RetainVersions < 0 || options.RetainVersionAge < 0 {
+		return errors.New("version retention must not be negative")
+	}
+	// 历史版本只保存在内存中，需要在打开时从数据文件中加载
+	if (options.RetainVersions > 0 || options.RetainVersionAge > 0) && options.IndexType == BPlusTree {
+		return ErrVersioningNotSupported
+	}
+	if !index.IsBytewise(options.Comparator) && (options.IndexType == ART || options.IndexType == BPlusTree) {
+		return ErrComparatorNotSupported
+	}
+	// B+ 树索引直接读写磁盘上的索引文件，不经过 VFS
+	if _, ok := options.FS.(fio.OSFS); options.FS != nil && !ok && options.IndexType == BPlusTree {
+		return ErrFileSystemNotSupported
+	}
+	if int64(options.MaxKeySize) > options.DataFileSize || int64(options.MaxValueSize) > options.DataFileSize {
+		return errors.New("max key size and max value size must not exceed the data file size")
+	}
+	return nil
+}
+
+// 检查 key 和 value 的长度，保证编码之后的记录能够写入到一个数据文件中，并且长度不超过 uint32
+func (db *DB) checkKeyValueSize(key, value []byte) error {
+	if db.options.MaxKeySize > 0 && uint64(len(key)) > uint64(db.options.MaxKeySize) {
+		return ErrKeyTooLarge
+	}
+	if db.options.MaxValueSize > 0 && uint64(len(value)) > uint64(db.options.MaxValueSize) {
+		return ErrValueTooLarge
+	}
+	// key 在写入时会加上变长的事务序列号，开启多版本时 value 会加上序列号和写入时间
+	valueSize := len(value)
+	if db.versioned() {
+		valueSize += binary.MaxVarintLen64 * 2
+	}
+	recordSize := data.MaxEncodedLogRecordSize(len(key)+binary.MaxVarintLen64, valueSize)
+	if recordSize > db.options.DataFileSize || recordSize > math.MaxUint32 {
+		return ErrRecordTooLarge
+	}
 	return nil
 }
 
 func (db *DB) loadSeqNo() error {
 	fileName := filepath.Join(db.options.DirPath, data.SeqNoFileName)
-	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+	if _, err := db.options.FS.Stat(fileName); os.IsNotExist(err) {
 		return nil
 	}
 
-	seqNoFile, err := data.OpenSeqNoFile(db.options.DirPath)
+	seqNoFile, err := data.OpenSeqNoFile(db.options.FS, db.options.DirPath)
 	if err != nil {
 		return err
 	}
@@ -622,9 +936,101 @@ func (db *DB) loadSeqNo() error {
 		return err
 	}
 	db.seqNo = seqNo
-	db.seqNoFileExists = true
 
-	return os.Remove(fileName)
+	return db.options.FS.Remove(fileName)
+}
+
+// 检查数据目录记录的比较器和配置的是否一致，目录中没有记录时写入当前比较器的名称
+// 没有记录比较器的旧数据目录按照字节序排序
+func (db *DB) checkComparator() error {
+	name := index.BytewiseComparator.Name()
+	if db.options.Comparator != nil {
+		name = db.options.Comparator.Name()
+	}
+
+	fileName := filepath.Join(db.options.DirPath, data.OptionsFileName)
+	_, err := db.options.FS.Stat(fileName)
+	if err == nil {
+		stored, err := readComparatorName(db.options.FS, db.options.DirPath)
+		if err != nil {
+			return err
+		}
+		if stored != name {
+			return fmt.Errorf("%w: %s, the database uses %s", ErrComparatorMismatch, name, stored)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	entries, err := db.options.FS.ReadDir(db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), data.DataFileNameSuffix) && name != index.BytewiseComparator.Name() {
+			return fmt.Errorf("%w: %s, the database uses %s", ErrComparatorMismatch, name, index.BytewiseComparator.Name())
+		}
+	}
+
+	optionsFile, err := data.OpenOptionsFile(db.options.FS, db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	defer optionsFile.Close()
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   []byte(comparatorKey),
+		Value: []byte(name),
+	})
+	if err := optionsFile.Write(encRecord); err != nil {
+		return err
+	}
+	return optionsFile.Sync()
+}
+
+// 从 options 文件中读取比较器的名称
+func readComparatorName(fs fio.VFS, dirPath string) (string, error) {
+	optionsFile, err := data.OpenOptionsFile(fs, dirPath)
+	if err != nil {
+		return "", err
+	}
+	defer optionsFile.Close()
+
+	name := index.BytewiseComparator.Name()
+	var offset int64 = 0
+	for {
+		record, size, err := optionsFile.ReadLogRecord(offset)
+		if err == io.EOF {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if string(record.Key) == comparatorKey {
+			name = string(record.Value)
+		}
+		offset += size
+	}
+}
+
+// 将活跃文件截断到 WriteOff
+func (db *DB) trimActiveFile() error {
+	if db.activeFile == nil {
+		return nil
+	}
+	// 预分配的空间和按块扩大的部分不一定体现在 Size 中，按照磁盘上的大小判断
+	size, err := db.activeFile.IoManager.Size()
+	if sizer, ok := db.activeFile.IoManager.(fio.PhysicalSizer); ok {
+		size, err = sizer.PhysicalSize()
+	}
+	if err != nil {
+		return err
+	}
+	if size > db.activeFile.WriteOff {
+		return db.activeFile.IoManager.Truncate(db.activeFile.WriteOff)
+	}
+	return nil
 }
 
 // 将数据文件的 IO 类型设置为标准文件 IO
@@ -633,11 +1039,11 @@ func (db *DB) resetIoType() error {
 		return nil
 	}
 
-	if err := db.activeFile.SetIOManager(db.options.DirPath, fio.StandardFIO); err != nil {
+	if err := db.activeFile.SetIOManager(db.options.FS, db.options.DirPath, db.options.IOType); err != nil {
 		return err
 	}
 	for _, dataFile := range db.olderFiles {
-		if err := dataFile.SetIOManager(db.options.DirPath, fio.StandardFIO); err != nil {
+		if err := dataFile.SetIOManager(db.options.FS, db.options.DirPath, db.options.IOType); err != nil {
 			return err
 		}
 	}
@@ -1,9 +1,16 @@
 package bitcask_go
 
 import (
+	"bitcask-go/data"
+	"bitcask-go/fio"
+	"bitcask-go/index"
 	"bitcask-go/utils"
+	"encoding/binary"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 )
 
@@ -18,7 +25,7 @@ func destroyDB(db *DB) {
 				_ = of.Close()
 			}
 		}
-		err := os.RemoveAll(db.options.DirPath)
+		err := db.options.FS.RemoveAll(db.options.DirPath)
 		if err != nil {
 			panic(err)
 		}
@@ -100,6 +107,103 @@ func TestDB_Put(t *testing.T) {
 	assert.Equal(t, val4, val5)
 }
 
+func TestDB_Put_SizeLimit(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-put-size-limit")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.MaxKeySize = 32
+	opts.MaxValueSize = 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	err = db.Put(make([]byte, 32), make([]byte, 1024))
+	assert.Nil(t, err)
+	err = db.Put(make([]byte, 33), utils.RandomValue(10))
+	assert.Equal(t, ErrKeyTooLarge, err)
+	err = db.Put(utils.GetTestKey(1), make([]byte, 1025))
+	assert.Equal(t, ErrValueTooLarge, err)
+	err = db.Delete(make([]byte, 33))
+	assert.Equal(t, ErrKeyTooLarge, err)
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	err = wb.Put(make([]byte, 33), utils.RandomValue(10))
+	assert.Equal(t, ErrKeyTooLarge, err)
+	err = wb.Put(utils.GetTestKey(1), make([]byte, 1025))
+	assert.Equal(t, ErrValueTooLarge, err)
+
+	// 没有设置 value 的最大长度时，记录不能超过数据文件的大小
+	db.options.MaxValueSize = 0
+	err = db.Put(utils.GetTestKey(1), make([]byte, 64*1024))
+	assert.Equal(t, ErrRecordTooLarge, err)
+	err = db.Put(utils.GetTestKey(1), make([]byte, 32*1024))
+	assert.Nil(t, err)
+
+	// 最大长度超过了数据文件的大小
+	opts2 := opts
+	opts2.MaxValueSize = 128 * 1024
+	_, err = Open(opts2)
+	assert.NotNil(t, err)
+}
+
+func TestDB_PutWithOptions(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-put-with-options")
+	opts.DirPath = dir
+	metrics := newTestMetrics()
+	opts.Metrics = metrics
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// 默认不持久化
+	for i := 0; i < 10; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, uint64(0), metrics.counters[MetricFsyncTotal])
+	assert.True(t, db.bytesWrite > 0)
+
+	// 持久化的写入同时持久化之前写入的数据
+	err = db.PutWithOptions(utils.GetTestKey(10), utils.RandomValue(24), WriteOptions{Sync: true})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), metrics.counters[MetricFsyncTotal])
+	assert.Equal(t, uint(0), db.bytesWrite)
+
+	err = db.DeleteWithOptions(utils.GetTestKey(1), WriteOptions{Sync: true})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), metrics.counters[MetricFsyncTotal])
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = db.DeleteWithOptions(utils.GetTestKey(2), DefaultWriteOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), metrics.counters[MetricFsyncTotal])
+
+	// 批量写入只持久化一次
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	for i := 20; i < 30; i++ {
+		_ = wb.Put(utils.GetTestKey(i), utils.RandomValue(24))
+	}
+	assert.Nil(t, wb.Commit())
+	assert.Equal(t, uint64(3), metrics.counters[MetricFsyncTotal])
+
+	// 全局配置了 SyncWrites 时，批量写入也只持久化一次
+	db.options.SyncWrites = true
+	wbOpts := DefaultWriteBatchOptions
+	wbOpts.SyncWrites = false
+	wb = db.NewWriteBatch(wbOpts)
+	for i := 30; i < 40; i++ {
+		_ = wb.Put(utils.GetTestKey(i), utils.RandomValue(24))
+	}
+	assert.Nil(t, wb.Commit())
+	assert.Equal(t, uint64(4), metrics.counters[MetricFsyncTotal])
+	err = db.PutWithOptions(utils.GetTestKey(40), utils.RandomValue(24), DefaultWriteOptions)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), metrics.counters[MetricFsyncTotal])
+}
+
 func TestDB_Get(t *testing.T) {
 	opts := DefaultOptions
 	dir, _ := os.MkdirTemp("", "bitcask-go-get")
@@ -399,6 +503,417 @@ func TestDB_Backup(t *testing.T) {
 	assert.NotNil(t, db2)
 }
 
+func TestDB_MMapIOType(t *testing.T) {
+	for _, indexType := range []IndexerType{BTree, BPlusTree} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-mmap-io")
+		opts.DirPath = dir
+		opts.DataFileSize = 64 * 1024
+		opts.IOType = fio.MemoryMap
+		opts.IndexType = indexType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		for i := 0; i < 1000; i++ {
+			err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+			assert.Nil(t, err)
+		}
+		assert.True(t, len(db.olderFiles) > 0)
+		assert.Nil(t, db.Sync())
+		val, err := db.Get(utils.GetTestKey(1))
+		assert.Nil(t, err)
+		assert.NotNil(t, val)
+
+		// 模拟崩溃，活跃文件末尾留下预分配的部分
+		activeFileName := data.GetDataFileName(dir, db.activeFile.FileId)
+		activeSize := db.activeFile.WriteOff
+		assert.Nil(t, db.Close())
+		assert.Nil(t, os.Truncate(activeFileName, activeSize+4096))
+
+		db2, err := Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, activeSize, db2.activeFile.WriteOff)
+		err = db2.Put(utils.GetTestKey(1000), []byte("value-1000"))
+		assert.Nil(t, err)
+		assert.Nil(t, db2.Close())
+
+		// 使用标准文件 IO 读取
+		opts.IOType = fio.StandardFIO
+		db3, err := Open(opts)
+		assert.Nil(t, err)
+		val, err = db3.Get(utils.GetTestKey(1000))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value-1000"), val)
+		assert.Equal(t, 1001, len(db3.ListKeys()))
+		destroyDB(db3)
+	}
+}
+
+func TestDB_DirectAndDSyncIOType(t *testing.T) {
+	for _, ioType := range []fio.FileIOType{fio.DirectIO, fio.DSyncIO} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-direct-io")
+		opts.DirPath = dir
+		opts.DataFileSize = 64 * 1024
+		opts.IOType = ioType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		err = db.Put(utils.GetTestKey(0), utils.RandomValue(128))
+		// 部分文件系统不支持 O_DIRECT，例如 tmpfs
+		if errors.Is(err, syscall.EINVAL) {
+			destroyDB(db)
+			t.Skip("direct io is not supported by the file system")
+		}
+		assert.Nil(t, err)
+		for i := 1; i < 1000; i++ {
+			err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+			assert.Nil(t, err)
+		}
+		assert.True(t, len(db.olderFiles) > 0)
+		val, err := db.Get(utils.GetTestKey(999))
+		assert.Nil(t, err)
+		assert.NotNil(t, val)
+		assert.Nil(t, db.Close())
+
+		db2, err := Open(opts)
+		assert.Nil(t, err)
+		err = db2.Put(utils.GetTestKey(1000), []byte("value-1000"))
+		assert.Nil(t, err)
+		val, err = db2.Get(utils.GetTestKey(1000))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value-1000"), val)
+		assert.Equal(t, 1001, len(db2.ListKeys()))
+		destroyDB(db2)
+	}
+}
+
+func TestDB_PreallocateActiveFile(t *testing.T) {
+	// 直接 IO 放在最后，文件系统不支持时跳过
+	for _, c := range []struct {
+		indexType IndexerType
+		ioType    fio.FileIOType
+	}{
+		{BTree, fio.StandardFIO},
+		{ART, fio.StandardFIO},
+		{BPlusTree, fio.StandardFIO},
+		{BTree, fio.MemoryMap},
+		{BTree, fio.DirectIO},
+	} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-preallocate")
+		opts.DirPath = dir
+		opts.DataFileSize = 64 * 1024
+		opts.PreallocateSize = 16 * 1024
+		opts.IndexType = c.indexType
+		opts.IOType = c.ioType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		err = db.Put(utils.GetTestKey(0), utils.RandomValue(128))
+		// 部分文件系统不支持 O_DIRECT，例如 tmpfs
+		if errors.Is(err, syscall.EINVAL) {
+			destroyDB(db)
+			t.Skip("direct io is not supported by the file system")
+		}
+		assert.Nil(t, err)
+		for i := 1; i < 1000; i++ {
+			err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+			assert.Nil(t, err)
+		}
+		assert.True(t, len(db.olderFiles) > 0)
+		// 切换活跃文件时旧的数据文件已经去掉了预分配的部分
+		for _, dataFile := range db.olderFiles {
+			stat, err := os.Stat(data.GetDataFileName(dir, dataFile.FileId))
+			assert.Nil(t, err)
+			assert.Equal(t, dataFile.WriteOff, stat.Size())
+		}
+		// 活跃文件按照 PreallocateSize 预分配
+		activeFileName := data.GetDataFileName(dir, db.activeFile.FileId)
+		activeSize := db.activeFile.WriteOff
+		stat, err := os.Stat(activeFileName)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), stat.Size()%opts.PreallocateSize)
+		assert.True(t, stat.Size() > activeSize)
+
+		// 模拟崩溃，备份的活跃文件末尾留有预分配的部分
+		backupDir, _ := os.MkdirTemp("", "bitcask-go-preallocate-backup")
+		assert.Nil(t, db.Sync())
+		assert.Nil(t, db.Backup(backupDir))
+
+		assert.Nil(t, db.Close())
+		stat, err = os.Stat(activeFileName)
+		assert.Nil(t, err)
+		assert.Equal(t, activeSize, stat.Size())
+		assert.Nil(t, os.RemoveAll(dir))
+
+		opts.DirPath = backupDir
+		db2, err := Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, activeSize, db2.activeFile.WriteOff)
+		assert.Equal(t, 1000, len(db2.ListKeys()))
+		err = db2.Put(utils.GetTestKey(1000), []byte("value-1000"))
+		assert.Nil(t, err)
+		assert.Nil(t, db2.Close())
+
+		db3, err := Open(opts)
+		assert.Nil(t, err)
+		val, err := db3.Get(utils.GetTestKey(1000))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value-1000"), val)
+		assert.Equal(t, 1001, len(db3.ListKeys()))
+		destroyDB(db3)
+	}
+}
+
+func TestDB_PreallocateTornRecord(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-preallocate-torn")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.PreallocateSize = 16 * 1024
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.Sync())
+	activeSize := db.activeFile.WriteOff
+
+	// 模拟崩溃，活跃文件末尾的记录只写了一部分，之后是预分配的 0
+	backupDir, _ := os.MkdirTemp("", "bitcask-go-preallocate-torn-backup")
+	assert.Nil(t, db.Backup(backupDir))
+	destroyDB(db)
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{Key: logRecordKeyWithSeq([]byte("torn"), nonTransactionSeqNo), Value: []byte("value"), Type: data.LogRecordNormal})
+	activeFile, err := os.OpenFile(data.GetDataFileName(backupDir, db.activeFile.FileId), os.O_RDWR, 0644)
+	assert.Nil(t, err)
+	_, err = activeFile.WriteAt(encRecord[:len(encRecord)-3], activeSize)
+	assert.Nil(t, err)
+	assert.Nil(t, activeFile.Close())
+
+	opts.DirPath = backupDir
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, activeSize, db2.activeFile.WriteOff)
+	assert.Equal(t, 100, len(db2.ListKeys()))
+	_, err = db2.Get([]byte("torn"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 没有写完整的记录被截断，之后的写入紧接着已有的数据
+	assert.Nil(t, db2.Put([]byte("key"), []byte("value")))
+	assert.Nil(t, db2.Close())
+	db3, err := Open(opts)
+	assert.Nil(t, err)
+	val, err := db3.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), val)
+	assert.Equal(t, 101, len(db3.ListKeys()))
+	destroyDB(db3)
+
+	// 损坏的记录之后还有数据时不是没有写完整的记录，仍然返回错误
+	dir, _ = os.MkdirTemp("", "bitcask-go-preallocate-corrupt")
+	opts.DirPath = dir
+	db4, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db4.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	fileId := db4.activeFile.FileId
+	assert.Nil(t, db4.Close())
+	activeFile, err = os.OpenFile(data.GetDataFileName(dir, fileId), os.O_RDWR, 0644)
+	assert.Nil(t, err)
+	_, err = activeFile.WriteAt([]byte{0xff}, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, activeFile.Close())
+	_, err = Open(opts)
+	assert.Equal(t, data.ErrInvalidCRC, err)
+	assert.Nil(t, os.RemoveAll(dir))
+}
+
+func TestDB_MemFS(t *testing.T) {
+	for _, indexType := range []IndexerType{BTree, ART, Hash, SkipList} {
+		opts := DefaultOptions
+		opts.DirPath = "/bitcask-go-memfs"
+		opts.DataFileSize = 64 * 1024
+		opts.IndexType = indexType
+		opts.FS = fio.NewMemFS()
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		for i := 0; i < 1000; i++ {
+			err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+			assert.Nil(t, err)
+		}
+		for i := 0; i < 1000; i++ {
+			err := db.Put(utils.GetTestKey(i), []byte("new-value"))
+			assert.Nil(t, err)
+		}
+		_, err = Open(opts)
+		assert.Equal(t, ErrDatabaseIsUsing, err)
+
+		assert.Nil(t, db.Merge())
+		assert.Nil(t, db.Backup("/bitcask-go-memfs-backup"))
+		assert.Nil(t, db.Close())
+
+		// 数据只保存在内存中
+		_, err = os.Stat(opts.DirPath)
+		assert.True(t, os.IsNotExist(err))
+
+		// 重新打开时应用 merge 的结果
+		db2, err := Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, 1000, len(db2.ListKeys()))
+		val, err := db2.Get(utils.GetTestKey(10))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("new-value"), val)
+		assert.Equal(t, int64(0), db2.Stat().ReclaimableSize)
+		destroyDB(db2)
+
+		opts.DirPath = "/bitcask-go-memfs-backup"
+		db3, err := Open(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, 1000, len(db3.ListKeys()))
+		destroyDB(db3)
+	}
+
+	// B+ 树索引文件不经过 VFS，只支持操作系统的文件系统
+	opts := DefaultOptions
+	opts.IndexType = BPlusTree
+	opts.FS = fio.NewMemFS()
+	_, err := Open(opts)
+	assert.Equal(t, ErrFileSystemNotSupported, err)
+	opts.FS = fio.NewFaultFS(fio.OSFS{})
+	_, err = Open(opts)
+	assert.Equal(t, ErrFileSystemNotSupported, err)
+}
+
+// 按照字节序倒序排列的比较器
+type reverseComparator struct{}
+
+func (reverseComparator) Name() string { return "test.ReverseComparator" }
+
+func (reverseComparator) Compare(a, b []byte) int { return -index.BytewiseComparator.Compare(a, b) }
+
+func TestDB_Comparator(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = "/bitcask-go-comparator"
+	opts.FS = fio.NewMemFS()
+	opts.Comparator = reverseComparator{}
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for _, key := range []string{"a1", "b1", "a2", "c1", "b2"} {
+		assert.Nil(t, db.Put([]byte(key), []byte(key)))
+	}
+
+	var keys []string
+	iter := db.NewIterator(IteratorOptions{Prefix: []byte("b")})
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	iter.Close()
+	assert.Equal(t, []string{"b2", "b1"}, keys)
+	assert.Nil(t, db.Close())
+
+	// 使用不同的比较器重新打开
+	defaultOpts := opts
+	defaultOpts.Comparator = DefaultOptions.Comparator
+	_, err = Open(defaultOpts)
+	assert.True(t, errors.Is(err, ErrComparatorMismatch))
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("c1"), []byte("b2"), []byte("b1"), []byte("a2"), []byte("a1")}, db.ListKeys())
+	destroyDB(db)
+
+	// 已经有数据的目录按照字节序排序
+	db, err = Open(defaultOpts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("a1"), []byte("a1")))
+	assert.Nil(t, db.Close())
+	assert.Nil(t, opts.FS.Remove(opts.DirPath+"/"+data.OptionsFileName))
+	_, err = Open(opts)
+	assert.True(t, errors.Is(err, ErrComparatorMismatch))
+	db, err = Open(defaultOpts)
+	assert.Nil(t, err)
+	destroyDB(db)
+
+	// 其他的索引类型不支持自定义的比较器
+	for _, indexType := range []IndexerType{ART, BPlusTree} {
+		opts := DefaultOptions
+		opts.IndexType = indexType
+		opts.Comparator = reverseComparator{}
+		_, err = Open(opts)
+		assert.Equal(t, ErrComparatorNotSupported, err)
+	}
+}
+
+// 解码定长 key 的比较器，按照数值倒序排列，key 的长度不足时 panic
+type uint64Comparator struct{}
+
+func (uint64Comparator) Name() string { return "test.Uint64Comparator" }
+
+func (uint64Comparator) Compare(a, b []byte) int {
+	x, y := binary.BigEndian.Uint64(a), binary.BigEndian.Uint64(b)
+	switch {
+	case x > y:
+		return -1
+	case x < y:
+		return 1
+	}
+	return 0
+}
+
+func TestDB_ComparatorPrefix(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = "/bitcask-go-comparator-prefix"
+	opts.FS = fio.NewMemFS()
+	opts.Comparator = uint64Comparator{}
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	for _, n := range []uint64{0x0101, 0x0201, 0x0102, 0x0202, 0x0103} {
+		key := binary.BigEndian.AppendUint64(nil, n)
+		assert.Nil(t, db.Put(key, key))
+	}
+
+	// 前缀比 key 的长度短，按照字节匹配，不会交给比较器
+	var keys []uint64
+	iter := db.NewIterator(IteratorOptions{Prefix: []byte{0, 0, 0, 0, 0, 0, 0x01}})
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		keys = append(keys, binary.BigEndian.Uint64(iter.Key()))
+	}
+	iter.Close()
+	assert.Equal(t, []uint64{0x0103, 0x0102, 0x0101}, keys)
+}
+
+// 打开失败之后释放文件锁和索引，在同一个进程中可以重新打开
+func TestDB_OpenFailed(t *testing.T) {
+	for _, indexType := range []IndexerType{BTree, BPlusTree} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-open-failed")
+		opts.DirPath = dir
+		opts.IndexType = indexType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+		assert.Nil(t, db.Put(utils.GetTestKey(1), utils.GetTestKey(1)))
+		assert.Nil(t, db.Close())
+
+		corrupted := filepath.Join(dir, "corrupted"+data.DataFileNameSuffix)
+		assert.Nil(t, os.WriteFile(corrupted, nil, fio.DataFilePerm))
+		_, err = Open(opts)
+		assert.Equal(t, ErrDataDirectoryCorrupted, err)
+
+		assert.Nil(t, os.Remove(corrupted))
+		db, err = Open(opts)
+		assert.Nil(t, err)
+		val, err := db.Get(utils.GetTestKey(1))
+		assert.Nil(t, err)
+		assert.Equal(t, utils.GetTestKey(1), val)
+		destroyDB(db)
+	}
+}
+
 //func TestDB_OpenMMap(t *testing.T) {
 //	opts := DefaultOptions
 //	opts.DirPath = "/tmp/bitcask-go"
@@ -0,0 +1,59 @@
+package bitcask_go
+
+import (
+	"time"
+)
+
+// DiskSpaceInfo 磁盘剩余空间状态
+type DiskSpaceInfo struct {
+	Available uint64 // 数据目录所在磁盘的剩余可用空间
+	Threshold uint64 // 配置项 MinFreeDiskBytes
+	Full      bool   // 剩余空间是否低于阈值，为 true 时数据库只读
+}
+
+// 检查数据目录所在磁盘的剩余空间，低于阈值时将数据库置为只读，空间释放后自动恢复写入
+// 返回磁盘空间是否充足
+func (db *DB) checkDiskSpace() bool {
+	threshold := db.options.MinFreeDiskBytes
+	if threshold == 0 {
+		return true
+	}
+	available, err := db.options.FS.AvailableSpace(db.options.DirPath)
+	if err != nil {
+		// 获取失败时保持原来的状态
+		return !db.diskFull.Load()
+	}
+
+	full := available < threshold
+	if db.diskFull.Swap(full) != full {
+		db.options.EventListener.OnDiskSpaceChanged(DiskSpaceInfo{
+			Available: available,
+			Threshold: threshold,
+			Full:      full,
+		})
+	}
+	return !full
+}
+
+// 后台定期检查磁盘剩余空间
+func (db *DB) diskSpaceLoop() {
+	defer db.bgWg.Done()
+	ticker := time.NewTicker(db.options.DiskCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-db.closeCh:
+			return
+		case <-ticker.C:
+			db.checkDiskSpace()
+		}
+	}
+}
+
+// 停止所有的后台任务
+func (db *DB) stopBackgroundTasks() {
+	db.closeOnce.Do(func() {
+		close(db.closeCh)
+	})
+	db.bgWg.Wait()
+}
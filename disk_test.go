@@ -0,0 +1,82 @@
+package bitcask_go
+
+import (
+	"bitcask-go/fio"
+	"bitcask-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type diskSpaceListener struct {
+	NopEventListener
+	infos chan DiskSpaceInfo
+}
+
+func (l *diskSpaceListener) OnDiskSpaceChanged(info DiskSpaceInfo) {
+	l.infos <- info
+}
+
+// 模拟磁盘剩余空间变化的文件系统
+type diskSpaceFS struct {
+	fio.VFS
+	available atomic.Uint64
+}
+
+func (fs *diskSpaceFS) AvailableSpace(string) (uint64, error) {
+	return fs.available.Load(), nil
+}
+
+func TestDB_MinFreeDiskBytes(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-disk-full")
+	opts.DirPath = dir
+	opts.MinFreeDiskBytes = 1024
+	opts.DiskCheckInterval = 10 * time.Millisecond
+
+	// 模拟磁盘剩余空间的变化
+	fs := &diskSpaceFS{VFS: fio.OSFS{}}
+	fs.available.Store(4096)
+	opts.FS = fs
+
+	listener := &diskSpaceListener{infos: make(chan DiskSpaceInfo, 10)}
+	opts.EventListener = listener
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(10))
+	assert.Nil(t, err)
+	assert.False(t, db.Stat().DiskFull)
+
+	// 磁盘剩余空间低于阈值，写入会失败，读取正常
+	fs.available.Store(100)
+	info := <-listener.infos
+	assert.True(t, info.Full)
+	assert.Equal(t, uint64(100), info.Available)
+	assert.Equal(t, uint64(1024), info.Threshold)
+	assert.True(t, db.Stat().DiskFull)
+
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	assert.Equal(t, ErrDiskFull, err)
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Equal(t, ErrDiskFull, err)
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	_ = wb.Put(utils.GetTestKey(3), utils.RandomValue(10))
+	assert.Equal(t, ErrDiskFull, wb.Commit())
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+
+	// 空间恢复之后自动恢复写入
+	fs.available.Store(2048)
+	info = <-listener.infos
+	assert.False(t, info.Full)
+	assert.False(t, db.Stat().DiskFull)
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	assert.Nil(t, err)
+	assert.Nil(t, wb.Commit())
+}
@@ -3,14 +3,25 @@ package bitcask_go
 import "errors"
 
 var (
-	ErrKeyIsEmpty             = errors.New("the key is empty")
-	ErrIndexUpdateFailed      = errors.New("failed to update index")
-	ErrKeyNotFound            = errors.New("key not found in database")
-	ErrDataFileNotFound       = errors.New("data file is not found")
-	ErrDataDirectoryCorrupted = errors.New("the database directory maybe corrupted")
-	ErrExceedMaxBatchNum      = errors.New("exceed the max batch num")
-	ErrMergeIsProgress        = errors.New("merge is in progress, try again later")
-	ErrDatabaseIsUsing        = errors.New("the database directory is used by another process")
-	ErrMergeRatioUnreached    = errors.New("the merge ratio do not reach the option")
-	ErrNoEnoughSpaceForMerge  = errors.New("no enough disk space for merge")
+	ErrKeyIsEmpty              = errors.New("the key is empty")
+	ErrIndexUpdateFailed       = errors.New("failed to update index")
+	ErrKeyNotFound             = errors.New("key not found in database")
+	ErrDataFileNotFound        = errors.New("data file is not found")
+	ErrDataDirectoryCorrupted  = errors.New("the database directory maybe corrupted")
+	ErrExceedMaxBatchNum       = errors.New("exceed the max batch num")
+	ErrMergeIsProgress         = errors.New("merge is in progress, try again later")
+	ErrDatabaseIsUsing         = errors.New("the database directory is used by another process")
+	ErrMergeRatioUnreached     = errors.New("the merge ratio do not reach the option")
+	ErrNoEnoughSpaceForMerge   = errors.New("no enough disk space for merge")
+	ErrDiskFull                = errors.New("free disk space is below the threshold, database is read-only")
+	ErrUnsupportedExportFormat = errors.New("unsupported export format")
+	ErrInvalidDumpRecord       = errors.New("invalid record in the dump stream")
+	ErrKeyTooLarge             = errors.New("the key exceeds the max key size")
+	ErrValueTooLarge           = errors.New("the value exceeds the max value size")
+	ErrRecordTooLarge          = errors.New("the key and value do not fit in a single data file")
+	ErrComparatorNotSupported  = errors.New("the index type does not support custom comparator")
+	ErrComparatorMismatch      = errors.New("the comparator does not match the one used to create the database")
+	ErrVersioningDisabled      = errors.New("versioning is disabled, set RetainVersions or RetainVersionAge to enable it")
+	ErrVersioningNotSupported  = errors.New("the index type does not support versioning")
+	ErrFileSystemNotSupported  = errors.New("the index type only supports the os file system")
 )
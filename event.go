@@ -0,0 +1,106 @@
+package bitcask_go
+
+import "time"
+
+// EventListener 存储引擎内部事件的监听接口，可以用于日志记录和告警
+// 回调在引擎内部同步执行，部分回调执行时持有数据库的锁，实现中不能再调用 DB 的方法，且应尽快返回
+type EventListener interface {
+	// OnFileRotated 活跃文件写满，切换到新的活跃文件
+	OnFileRotated(info FileRotationInfo)
+
+	// OnMergeBegin merge 开始
+	OnMergeBegin(info MergeBeginInfo)
+
+	// OnMergeProgress 每处理完一个数据文件调用一次
+	OnMergeProgress(info MergeProgressInfo)
+
+	// OnMergeEnd merge 结束，无论成功与否都会调用
+	OnMergeEnd(info MergeEndInfo)
+
+	// OnRecovery 打开数据库时加载完索引后调用
+	OnRecovery(info RecoveryInfo)
+
+	// OnSyncError 持久化数据文件失败
+	OnSyncError(info SyncErrorInfo)
+
+	// OnDiskSpaceChanged 磁盘剩余空间低于阈值，或者重新恢复到阈值以上
+	OnDiskSpaceChanged(info DiskSpaceInfo)
+
+	// OnClose 数据库关闭
+	OnClose(info CloseInfo)
+}
+
+// FileRotationInfo 活跃文件切换信息
+type FileRotationInfo struct {
+	OldFileId   uint32 // 写满的活跃文件 id
+	NewFileId   uint32 // 新的活跃文件 id
+	OldFileSize int64  // 写满的活跃文件大小
+}
+
+// MergeBeginInfo merge 开始时的信息
+type MergeBeginInfo struct {
+	FileIds        []uint32 // 参与 merge 的数据文件 id
+	TotalBytes     int64    // 参与 merge 的数据总量
+	ReclaimBytes   int64    // 预计可以回收的数据量
+	NonMergeFileId uint32   // 最近没有参与 merge 的文件 id
+}
+
+// MergeProgressInfo merge 进度信息
+type MergeProgressInfo struct {
+	FileId       uint32 // 刚处理完的数据文件 id
+	FilesDone    int    // 已经处理完的文件数量
+	FilesTotal   int    // 需要处理的文件总数
+	BytesScanned int64  // 已经扫描过的数据量
+	BytesKept    int64  // 重写到新文件中的有效数据量
+}
+
+// MergeEndInfo merge 结束时的信息
+type MergeEndInfo struct {
+	FilesMerged  int           // 处理完的文件数量
+	BytesScanned int64         // 扫描过的数据量
+	BytesKept    int64         // 重写到新文件中的有效数据量
+	Duration     time.Duration // merge 耗时
+	Err          error         // merge 失败的原因，成功时为 nil
+}
+
+// RecoveryInfo 打开数据库时的恢复信息
+type RecoveryInfo struct {
+	DataFileNum        int           // 数据文件的数量
+	MergeApplied       bool          // 是否加载了上一次 merge 的结果
+	HintRecords        int           // 从 hint 文件中加载的索引数量
+	DataRecords        int           // 从数据文件中读取的记录数量
+	UncommittedTxns    int           // 没有完成标识、被丢弃的事务数量
+	UncommittedRecords int           // 被丢弃的事务中的记录数量
+	Duration           time.Duration // 恢复耗时
+}
+
+// SyncErrorInfo 持久化失败的信息
+type SyncErrorInfo struct {
+	FileId uint32 // 持久化失败的数据文件 id
+	Err    error
+}
+
+// CloseInfo 数据库关闭时的信息
+type CloseInfo struct {
+	SeqNo uint64 // 关闭时的事务序列号
+	Err   error  // 关闭失败的原因，成功时为 nil
+}
+
+// NopEventListener 不做任何处理的监听器，可以嵌入到自定义的监听器中，只实现关心的回调
+type NopEventListener struct{}
+
+func (NopEventListener) OnFileRotated(FileRotationInfo) {}
+
+func (NopEventListener) OnMergeBegin(MergeBeginInfo) {}
+
+func (NopEventListener) OnMergeProgress(MergeProgressInfo) {}
+
+func (NopEventListener) OnMergeEnd(MergeEndInfo) {}
+
+func (NopEventListener) OnRecovery(RecoveryInfo) {}
+
+func (NopEventListener) OnSyncError(SyncErrorInfo) {}
+
+func (NopEventListener) OnDiskSpaceChanged(DiskSpaceInfo) {}
+
+func (NopEventListener) OnClose(CloseInfo) {}
@@ -0,0 +1,135 @@
+package bitcask_go
+
+import (
+	"bitcask-go/data"
+	"bitcask-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+)
+
+// 测试使用的事件监听器，记录收到的所有事件
+type testEventListener struct {
+	NopEventListener
+	mu        sync.Mutex
+	rotations []FileRotationInfo
+	begins    []MergeBeginInfo
+	progress  []MergeProgressInfo
+	ends      []MergeEndInfo
+	recovery  []RecoveryInfo
+	closes    []CloseInfo
+}
+
+func (l *testEventListener) OnFileRotated(info FileRotationInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rotations = append(l.rotations, info)
+}
+
+func (l *testEventListener) OnMergeBegin(info MergeBeginInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.begins = append(l.begins, info)
+}
+
+func (l *testEventListener) OnMergeProgress(info MergeProgressInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.progress = append(l.progress, info)
+}
+
+func (l *testEventListener) OnMergeEnd(info MergeEndInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ends = append(l.ends, info)
+}
+
+func (l *testEventListener) OnRecovery(info RecoveryInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recovery = append(l.recovery, info)
+}
+
+func (l *testEventListener) OnClose(info CloseInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closes = append(l.closes, info)
+}
+
+func TestDB_EventListener(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-event")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.DataFileMergeRatio = 0
+	listener := &testEventListener{}
+	opts.EventListener = listener
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+	assert.Equal(t, 1, len(listener.recovery))
+	assert.Equal(t, 0, listener.recovery[0].DataFileNum)
+
+	for i := 0; i < 2000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, len(db.olderFiles), len(listener.rotations))
+	for i, info := range listener.rotations {
+		assert.Equal(t, uint32(i), info.OldFileId)
+		assert.Equal(t, uint32(i+1), info.NewFileId)
+		assert.True(t, info.OldFileSize > 0)
+	}
+
+	err = db.Merge()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(listener.begins))
+	filesTotal := len(listener.begins[0].FileIds)
+	assert.Equal(t, filesTotal, len(listener.progress))
+	assert.Equal(t, filesTotal, listener.progress[filesTotal-1].FilesDone)
+	assert.Equal(t, 1, len(listener.ends))
+	assert.Nil(t, listener.ends[0].Err)
+	assert.Equal(t, filesTotal, listener.ends[0].FilesMerged)
+	assert.Equal(t, listener.begins[0].TotalBytes, listener.ends[0].BytesScanned)
+
+	err = db.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(listener.closes))
+	assert.Nil(t, listener.closes[0].Err)
+
+	// 重启之后校验恢复信息
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(listener.recovery))
+	assert.True(t, listener.recovery[1].MergeApplied)
+	assert.True(t, listener.recovery[1].HintRecords > 0)
+}
+
+func TestDB_EventListener_UncommittedTxn(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-event-txn")
+	opts.DirPath = dir
+	listener := &testEventListener{}
+	opts.EventListener = listener
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// 直接写入一条没有完成标识的事务数据
+	_, err = db.appendLogRecordWithLock(&data.LogRecord{
+		Key:   logRecordKeyWithSeq(utils.GetTestKey(1), 100),
+		Value: utils.RandomValue(10),
+	}, DefaultWriteOptions)
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, listener.recovery[1].UncommittedTxns)
+	assert.Equal(t, 1, listener.recovery[1].UncommittedRecords)
+}
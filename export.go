@@ -0,0 +1,217 @@
+package bitcask_go
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+)
+
+type ExportFormat = int8
+
+const (
+	// ExportJSONL 每行一个 JSON 对象，key 和 value 使用 base64 编码
+	ExportJSONL ExportFormat = iota + 1
+
+	// ExportBinary 紧凑的二进制流格式
+	ExportBinary
+)
+
+// 二进制格式的文件头，Import 根据它判断输入的格式
+var binaryDumpMagic = []byte("BITCASK-DUMP\x01")
+
+// 导入时每个 WriteBatch 中的数据量
+const importBatchSize = 1000
+
+// ExportRecord JSONL 格式中的一行数据，[]byte 类型在 JSON 中会被编码为 base64
+type ExportRecord struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// Export 将数据库中所有的 Key/Value 按照 key 的顺序导出到 w 中，返回导出的数据量
+// 导出时不会阻塞写入，导出的是创建迭代器时的索引快照
+// 核心的 DB 没有 TTL，导出的只有原始的 Key/Value，Redis 数据结构中的过期时间编码在 value 中，原样导出但不会单独处理
+// 需要按照过期时间导出的话使用 redis 包中的 RedisDataStructure.Export，只导出没有过期的数据并携带过期时间
+func (db *DB) Export(w io.Writer, format ExportFormat) (int, error) {
+	if format != ExportJSONL && format != ExportBinary {
+		return 0, ErrUnsupportedExportFormat
+	}
+
+	bw := bufio.NewWriter(w)
+	var enc *json.Encoder
+	if format == ExportJSONL {
+		enc = json.NewEncoder(bw)
+	} else {
+		if _, err := bw.Write(binaryDumpMagic); err != nil {
+			return 0, err
+		}
+	}
+
+	iter := db.NewIterator(DefaultIteratorOptions)
+	defer iter.Close()
+	var count int
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			// 迭代过程中被删除的 key 直接跳过
+			if err == ErrKeyNotFound {
+				continue
+			}
+			return count, err
+		}
+		if format == ExportJSONL {
+			err = enc.Encode(&ExportRecord{Key: iter.Key(), Value: value})
+		} else {
+			_, err = bw.Write(encodeDumpRecord(iter.Key(), value))
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, bw.Flush()
+}
+
+// Import 从 r 中读取 Export 导出的数据并写入到数据库中，自动识别输入的格式，返回导入的 key 的数量
+// 数据通过 WriteBatch 分批写入，每批次内是原子的，导入失败时已经提交的批次不会回滚
+// 同一个 key 出现多次时只计算一次，出错时返回已经提交的批次中的 key 的数量
+// 和 Export 一样不处理 TTL，携带过期时间的数据使用 redis 包中的 RedisDataStructure.Import 导入
+func (db *DB) Import(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	var next func() (*ExportRecord, error)
+	header, err := br.Peek(len(binaryDumpMagic))
+	if err == nil && bytes.Equal(header, binaryDumpMagic) {
+		_, _ = br.Discard(len(binaryDumpMagic))
+		next = func() (*ExportRecord, error) {
+			return decodeDumpRecord(br)
+		}
+	} else {
+		dec := json.NewDecoder(br)
+		next = func() (*ExportRecord, error) {
+			record := &ExportRecord{}
+			if err := dec.Decode(record); err != nil {
+				return nil, err
+			}
+			return record, nil
+		}
+	}
+
+	opts := DefaultWriteBatchOptions
+	opts.SyncWrites = false
+	wb := db.NewWriteBatch(opts)
+	// 提交成功之后才计入导入的 key
+	imported := make(map[string]struct{})
+	var pending [][]byte
+	commit := func() error {
+		if err := wb.Commit(); err != nil {
+			return err
+		}
+		for _, key := range pending {
+			imported[string(key)] = struct{}{}
+		}
+		pending = pending[:0]
+		return nil
+	}
+	for {
+		record, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return len(imported), err
+		}
+		if err := wb.Put(record.Key, record.Value); err != nil {
+			return len(imported), err
+		}
+		pending = append(pending, record.Key)
+		if len(pending) == importBatchSize {
+			if err := commit(); err != nil {
+				return len(imported), err
+			}
+		}
+	}
+	if err := commit(); err != nil {
+		return len(imported), err
+	}
+	return len(imported), db.Sync()
+}
+
+// 二进制格式中每条数据的编码
+//
+//	+-------------+-------------+--------------+-------------+--------------+
+//	| crc 校验值  |   key size  |   value size |      key    |      value   |
+//	+-------------+-------------+--------------+-------------+--------------+
+//	    4字节       变长（最大10）  变长（最大10）     变长           变长
+func encodeDumpRecord(key, value []byte) []byte {
+	buf := make([]byte, 4+binary.MaxVarintLen64*2+len(key)+len(value))
+	var index = 4
+	index += binary.PutUvarint(buf[index:], uint64(len(key)))
+	index += binary.PutUvarint(buf[index:], uint64(len(value)))
+	index += copy(buf[index:], key)
+	index += copy(buf[index:], value)
+
+	binary.LittleEndian.PutUint32(buf[:4], crc32.ChecksumIEEE(buf[4:index]))
+	return buf[:index]
+}
+
+func decodeDumpRecord(br *bufio.Reader) (*ExportRecord, error) {
+	crcBuf := make([]byte, 4)
+	if _, err := io.ReadFull(br, crcBuf); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrInvalidDumpRecord
+		}
+		return nil, err
+	}
+
+	// 读取 key 和 value 的长度，同时计算 crc
+	crc := crc32.NewIEEE()
+	sizeReader := io.TeeReader(br, crc)
+	keySize, err := binary.ReadUvarint(byteReader{sizeReader})
+	if err != nil {
+		return nil, ErrInvalidDumpRecord
+	}
+	valueSize, err := binary.ReadUvarint(byteReader{sizeReader})
+	if err != nil {
+		return nil, ErrInvalidDumpRecord
+	}
+
+	record := &ExportRecord{}
+	record.Key, err = readDumpBytes(sizeReader, keySize)
+	if err != nil {
+		return nil, err
+	}
+	record.Value, err = readDumpBytes(sizeReader, valueSize)
+	if err != nil {
+		return nil, err
+	}
+	if crc.Sum32() != binary.LittleEndian.Uint32(crcBuf) {
+		return nil, ErrInvalidDumpRecord
+	}
+	return record, nil
+}
+
+// 读取指定长度的数据，长度来自输入流，不能直接按照它分配内存
+func readDumpBytes(r io.Reader, size uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, int64(size))
+	if err != nil || uint64(n) != size {
+		return nil, ErrInvalidDumpRecord
+	}
+	return buf.Bytes(), nil
+}
+
+// 将 io.Reader 包装为 io.ByteReader，用于读取变长的长度信息
+type byteReader struct {
+	io.Reader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r.Reader, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
@@ -0,0 +1,125 @@
+package bitcask_go
+
+import (
+	"bitcask-go/utils"
+	"bytes"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDB_ExportImport(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-export")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2500; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+		assert.Nil(t, err)
+	}
+	// 二进制安全的 key 和 value
+	err = db.Put([]byte{0, '\n', 0xff}, []byte{0xff, '"', 0})
+	assert.Nil(t, err)
+	err = db.Delete(utils.GetTestKey(10))
+	assert.Nil(t, err)
+
+	for _, format := range []ExportFormat{ExportJSONL, ExportBinary} {
+		var buf bytes.Buffer
+		n, err := db.Export(&buf, format)
+		assert.Nil(t, err)
+		assert.Equal(t, 2500, n)
+
+		opts2 := DefaultOptions
+		dir2, _ := os.MkdirTemp("", "bitcask-go-import")
+		opts2.DirPath = dir2
+		db2, err := Open(opts2)
+		assert.Nil(t, err)
+
+		n, err = db2.Import(&buf)
+		assert.Nil(t, err)
+		assert.Equal(t, 2500, n)
+		assert.Equal(t, db.ListKeys(), db2.ListKeys())
+		_ = db.Fold(func(key []byte, value []byte) bool {
+			val, err := db2.Get(key)
+			assert.Nil(t, err)
+			assert.Equal(t, value, val)
+			return true
+		})
+		destroyDB(db2)
+	}
+
+	_, err = db.Export(&bytes.Buffer{}, 100)
+	assert.Equal(t, ErrUnsupportedExportFormat, err)
+}
+
+func TestDB_Import_Invalid(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-import-invalid")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// 被截断的二进制流
+	err = db.Put([]byte("a"), []byte("value-a"))
+	assert.Nil(t, err)
+	var buf bytes.Buffer
+	_, err = db.Export(&buf, ExportBinary)
+	assert.Nil(t, err)
+	_, err = db.Import(bytes.NewReader(buf.Bytes()[:buf.Len()-3]))
+	assert.Equal(t, ErrInvalidDumpRecord, err)
+
+	// 错误的 crc
+	data := buf.Bytes()
+	data[len(binaryDumpMagic)] ^= 0xff
+	_, err = db.Import(bytes.NewReader(data))
+	assert.Equal(t, ErrInvalidDumpRecord, err)
+
+	// JSONL 格式
+	n, err := db.Import(strings.NewReader(`{"key":"YQ==","value":"Yg=="}` + "\n" + `{"key":"Yw==","value":null}` + "\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	val, err := db.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), val)
+
+	_, err = db.Import(strings.NewReader(`{"key":"YQ==",`))
+	assert.NotNil(t, err)
+	_, err = db.Import(strings.NewReader(`{"key":"","value":"Yg=="}`))
+	assert.Equal(t, ErrKeyIsEmpty, err)
+}
+
+func TestDB_Import_Duplicate(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-import-duplicate")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// 同一个 key 在同一个批次和不同的批次中重复出现，只计算一次
+	var input strings.Builder
+	for i := 0; i < importBatchSize*2+10; i++ {
+		input.WriteString(`{"key":"` + base64.StdEncoding.EncodeToString(utils.GetTestKey(i%100)) + `","value":"Yg=="}` + "\n")
+	}
+	n, err := db.Import(strings.NewReader(input.String()))
+	assert.Nil(t, err)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, 100, len(db.ListKeys()))
+
+	// 出错时只返回已经提交的批次中的 key 的数量
+	input.Reset()
+	for i := 0; i < importBatchSize+10; i++ {
+		input.WriteString(`{"key":"` + base64.StdEncoding.EncodeToString(utils.GetTestKey(1000+i)) + `","value":"Yg=="}` + "\n")
+	}
+	input.WriteString(`{"key":"YQ==",`)
+	n, err = db.Import(strings.NewReader(input.String()))
+	assert.NotNil(t, err)
+	assert.Equal(t, importBatchSize, n)
+	assert.Equal(t, 100+importBatchSize, len(db.ListKeys()))
+}
@@ -0,0 +1,164 @@
+package fio
+
+import (
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+)
+
+// 直接 IO 要求的对齐大小，内存地址、文件偏移和读写长度都需要按照它对齐
+const directIOAlignment = 4096
+
+// DirectFileIO 使用 O_DIRECT 打开文件，读写绕过页缓存
+// 文件末尾不足一个块的数据保存在内存中，每次写入时补齐为完整的块写入到文件，关闭时截断到实际大小
+// 读取时按照块对齐之后读取，上层不需要关心对齐的要求
+type DirectFileIO struct {
+	mu   sync.RWMutex
+	fd   *os.File
+	size int64  // 实际写入的数据大小
+	tail []byte // 最后一个不完整的块中的数据
+}
+
+// NewDirectIOManager 初始化直接 IO，当前平台或者文件系统不支持时返回错误
+func NewDirectIOManager(fileName string) (*DirectFileIO, error) {
+	fd, err := openDirectFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	dio := &DirectFileIO{fd: fd}
+	if err := dio.loadTail(stat.Size()); err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	return dio, nil
+}
+
+func (dio *DirectFileIO) Read(b []byte, offset int64) (int, error) {
+	dio.mu.RLock()
+	defer dio.mu.RUnlock()
+	if offset >= dio.size {
+		return 0, io.EOF
+	}
+	end := offset + int64(len(b))
+	if end > dio.size {
+		end = dio.size
+	}
+
+	// 按照块对齐之后读取
+	start := alignDown(offset)
+	buf := alignedBlock(alignUp(end) - start)
+	if _, err := dio.fd.ReadAt(buf, start); err != nil && err != io.EOF {
+		return 0, err
+	}
+	n := copy(b, buf[offset-start:end-start])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (dio *DirectFileIO) Write(b []byte) (int, error) {
+	dio.mu.Lock()
+	defer dio.mu.Unlock()
+
+	// 将不完整的块和新的数据一起写入，最后一个块用 0 补齐
+	start := alignDown(dio.size)
+	length := int64(len(dio.tail) + len(b))
+	buf := alignedBlock(alignUp(length))
+	copy(buf, dio.tail)
+	copy(buf[len(dio.tail):], b)
+	if _, err := dio.fd.WriteAt(buf, start); err != nil {
+		return 0, err
+	}
+
+	dio.size += int64(len(b))
+	full := alignDown(length)
+	dio.tail = append(dio.tail[:0], buf[full:length]...)
+	return len(b), nil
+}
+
+// Sync 数据已经绕过页缓存写入，只需要持久化文件的元数据
+func (dio *DirectFileIO) Sync() error {
+	return dio.fd.Sync()
+}
+
+func (dio *DirectFileIO) Close() error {
+	dio.mu.Lock()
+	defer dio.mu.Unlock()
+	// 去掉最后一个块中补齐的部分
+	if err := dio.fd.Truncate(dio.size); err != nil {
+		return err
+	}
+	return dio.fd.Close()
+}
+
+// Preallocate 预分配磁盘空间，不改变写入的位置，预分配的部分只体现在 PhysicalSize 中
+func (dio *DirectFileIO) Preallocate(size int64) error {
+	return preallocate(dio.fd, size)
+}
+
+func (dio *DirectFileIO) Size() (int64, error) {
+	dio.mu.RLock()
+	defer dio.mu.RUnlock()
+	return dio.size, nil
+}
+
+// PhysicalSize 文件在磁盘上的大小，包括预分配的空间和最后一个块中补齐的部分
+func (dio *DirectFileIO) PhysicalSize() (int64, error) {
+	dio.mu.RLock()
+	defer dio.mu.RUnlock()
+	stat, err := dio.fd.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+func (dio *DirectFileIO) Truncate(size int64) error {
+	dio.mu.Lock()
+	defer dio.mu.Unlock()
+	if err := dio.fd.Truncate(size); err != nil {
+		return err
+	}
+	return dio.loadTail(size)
+}
+
+// 读取最后一个不完整的块
+func (dio *DirectFileIO) loadTail(size int64) error {
+	dio.size = size
+	dio.tail = dio.tail[:0]
+	start := alignDown(size)
+	if start == size {
+		return nil
+	}
+	buf := alignedBlock(directIOAlignment)
+	if _, err := dio.fd.ReadAt(buf, start); err != nil && err != io.EOF {
+		return err
+	}
+	dio.tail = append(dio.tail, buf[:size-start]...)
+	return nil
+}
+
+// 分配按照 directIOAlignment 对齐的内存
+func alignedBlock(size int64) []byte {
+	buf := make([]byte, size+directIOAlignment)
+	shift := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & (directIOAlignment - 1)); rem != 0 {
+		shift = directIOAlignment - rem
+	}
+	return buf[shift : int64(shift)+size : int64(shift)+size]
+}
+
+func alignDown(n int64) int64 {
+	return n &^ (directIOAlignment - 1)
+}
+
+func alignUp(n int64) int64 {
+	return alignDown(n + directIOAlignment - 1)
+}
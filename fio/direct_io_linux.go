@@ -0,0 +1,10 @@
+package fio
+
+import (
+	"os"
+	"syscall"
+)
+
+func openDirectFile(fileName string) (*os.File, error) {
+	return os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|syscall.O_DIRECT, DataFilePerm)
+}
@@ -0,0 +1,109 @@
+package fio
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func openDirectIOForTest(t *testing.T, path string) *DirectFileIO {
+	dio, err := NewDirectIOManager(path)
+	// 部分文件系统不支持 O_DIRECT，例如 tmpfs
+	if errors.Is(err, syscall.EINVAL) {
+		t.Skip("direct io is not supported by the file system")
+	}
+	assert.Nil(t, err)
+	return dio
+}
+
+func TestDirectIO_Write_Read(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-direct-io")
+	defer destroyFile(dir)
+	path := filepath.Join(dir, "a.data")
+	dio := openDirectIOForTest(t, path)
+
+	var expected []byte
+	for i, size := range []int{10, 100, 4000, 5000, 1, 9000} {
+		b := bytes.Repeat([]byte{byte('a' + i)}, size)
+		n, err := dio.Write(b)
+		assert.Nil(t, err)
+		assert.Equal(t, size, n)
+		expected = append(expected, b...)
+	}
+	size, err := dio.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(expected)), size)
+	// 文件按照块的大小补齐
+	stat, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, alignUp(size), stat.Size())
+
+	// 任意位置读取
+	for _, r := range [][2]int{{0, 10}, {5, 200}, {4090, 20}, {100, 10000}, {len(expected) - 3, 3}} {
+		b := make([]byte, r[1])
+		n, err := dio.Read(b, int64(r[0]))
+		assert.Nil(t, err)
+		assert.Equal(t, r[1], n)
+		assert.Equal(t, expected[r[0]:r[0]+r[1]], b)
+	}
+	b := make([]byte, 10)
+	n, err := dio.Read(b, int64(len(expected)-5))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 5, n)
+	assert.Nil(t, dio.Sync())
+
+	// 关闭时去掉补齐的部分
+	assert.Nil(t, dio.Close())
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, content)
+
+	// 重新打开之后继续追加写入
+	dio = openDirectIOForTest(t, path)
+	_, err = dio.Write([]byte("tail"))
+	assert.Nil(t, err)
+	expected = append(expected, []byte("tail")...)
+	assert.Nil(t, dio.Truncate(int64(len(expected)-2)))
+	_, err = dio.Write([]byte("xy"))
+	assert.Nil(t, err)
+	expected = append(expected[:len(expected)-2], []byte("xy")...)
+	assert.Nil(t, dio.Close())
+	content, err = os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, content)
+}
+
+func TestDirectIO_Preallocate(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-direct-io-preallocate")
+	defer destroyFile(dir)
+	path := filepath.Join(dir, "a.data")
+	dio := openDirectIOForTest(t, path)
+
+	_, err := dio.Write([]byte("key-a"))
+	assert.Nil(t, err)
+	assert.Nil(t, dio.Preallocate(64*1024))
+
+	// 预分配的部分不影响写入的位置，但是体现在磁盘上的大小中
+	size, err := dio.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), size)
+	physicalSize, err := dio.PhysicalSize()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(64*1024), physicalSize)
+
+	_, err = dio.Write([]byte("key-b"))
+	assert.Nil(t, err)
+	assert.Nil(t, dio.Truncate(10))
+	physicalSize, err = dio.PhysicalSize()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), physicalSize)
+	assert.Nil(t, dio.Close())
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("key-akey-b"), content)
+}
@@ -0,0 +1,11 @@
+package fio
+
+import (
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+// 使用 fallocate 分配 [0, size) 的磁盘空间，文件大小不足 size 时会被扩大
+func preallocate(fd *os.File, size int64) error {
+	return unix.Fallocate(int(fd.Fd()), 0, 0, size)
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package fio
+
+import "os"
+
+// 不支持 fallocate 的平台只扩大文件大小
+func preallocate(fd *os.File, size int64) error {
+	stat, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() >= size {
+		return nil
+	}
+	return fd.Truncate(size)
+}
@@ -0,0 +1,390 @@
+package fio
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	ErrInjectedFault = errors.New("injected io fault")
+	ErrCrashed       = errors.New("the file system has crashed")
+)
+
+// FaultFS 注入故障的文件系统，包装另一个 VFS，用于测试崩溃一致性
+// 可以让第 N 次写入失败或者只写入一部分，让第 N 次持久化失败，或者模拟进程崩溃丢弃所有没有持久化的数据
+// 目录操作（创建、删除、重命名）被认为是立即持久化的
+type FaultFS struct {
+	VFS
+	mu           sync.Mutex
+	synced       map[string]*faultFileState // 每个文件的持久化状态
+	openFiles    map[*faultFile]struct{}
+	locks        []io.Closer
+	writeFaultAt int  // 剩余多少次写入之后触发故障，0 表示不触发
+	shortWrite   bool // 触发故障时是否写入一半的数据
+	syncFaultAt  int  // 剩余多少次持久化之后触发故障，0 表示不触发
+}
+
+// NewFaultFS 初始化注入故障的文件系统
+func NewFaultFS(fs VFS) *FaultFS {
+	return &FaultFS{
+		VFS:       fs,
+		synced:    make(map[string]*faultFileState),
+		openFiles: make(map[*faultFile]struct{}),
+	}
+}
+
+// InjectWriteFault 从现在开始的第 n 次写入返回 ErrInjectedFault，short 为 true 时只写入一半的数据
+func (ffs *FaultFS) InjectWriteFault(n int, short bool) {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	ffs.writeFaultAt = n
+	ffs.shortWrite = short
+}
+
+// InjectSyncFault 从现在开始的第 n 次持久化返回 ErrInjectedFault，数据不会被持久化
+func (ffs *FaultFS) InjectSyncFault(n int) {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	ffs.syncFaultAt = n
+}
+
+// ClearFaults 清除还没有触发的故障
+func (ffs *FaultFS) ClearFaults() {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	ffs.writeFaultAt = 0
+	ffs.syncFaultAt = 0
+}
+
+// Crash 模拟进程崩溃，丢弃所有文件中上次持久化之后写入的数据，并释放所有的文件锁
+// 崩溃之前打开的文件都不能再使用，操作会返回 ErrCrashed
+func (ffs *FaultFS) Crash() error {
+	return ffs.TornCrash(0)
+}
+
+// TornCrash 和 Crash 一样模拟进程崩溃，但每个文件上次持久化之后写入的数据会保留前 n 个字节
+// 用于模拟崩溃时只有一部分数据落盘，留下没有写完整的记录
+func (ffs *FaultFS) TornCrash(n int64) error {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	for file := range ffs.openFiles {
+		file.crashed = true
+	}
+	ffs.openFiles = make(map[*faultFile]struct{})
+
+	for name, state := range ffs.synced {
+		ioManager, err := ffs.VFS.OpenFile(name, StandardFIO)
+		if err != nil {
+			return err
+		}
+		err = state.crash(ioManager, n)
+		if closeErr := ioManager.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// 崩溃之后留下的数据都认为是已经持久化的
+	ffs.synced = make(map[string]*faultFileState)
+
+	for _, lock := range ffs.locks {
+		if err := lock.Close(); err != nil {
+			return err
+		}
+	}
+	ffs.locks = nil
+	return nil
+}
+
+func (ffs *FaultFS) OpenFile(name string, ioType FileIOType) (IOManager, error) {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	name = filepath.Clean(name)
+	_, statErr := ffs.VFS.Stat(name)
+	ioManager, err := ffs.VFS.OpenFile(name, ioType)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	if statErr == nil {
+		if size, err = ioManager.Size(); err != nil {
+			_ = ioManager.Close()
+			return nil, err
+		}
+	}
+	if state, ok := ffs.synced[name]; ok {
+		// 和文件 IO 一样，从文件末尾开始写入
+		state.writeOff = size
+	} else {
+		// 已经存在的文件认为是持久化过的，新创建的文件没有任何持久化的数据
+		ffs.synced[name] = &faultFileState{writeOff: size, syncedOff: size, syncedSize: size}
+	}
+	file := &faultFile{fs: ffs, name: name, ioManager: ioManager}
+	ffs.openFiles[file] = struct{}{}
+	return file, nil
+}
+
+func (ffs *FaultFS) Remove(name string) error {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	if err := ffs.VFS.Remove(name); err != nil {
+		return err
+	}
+	delete(ffs.synced, filepath.Clean(name))
+	return nil
+}
+
+func (ffs *FaultFS) RemoveAll(path string) error {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	if err := ffs.VFS.RemoveAll(path); err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	for name := range ffs.synced {
+		if name == path || isSubPath(path, name) {
+			delete(ffs.synced, name)
+		}
+	}
+	return nil
+}
+
+func (ffs *FaultFS) Rename(oldPath, newPath string) error {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	if err := ffs.VFS.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	for name, state := range ffs.synced {
+		if name == oldPath || isSubPath(oldPath, name) {
+			delete(ffs.synced, name)
+			ffs.synced[newPath+name[len(oldPath):]] = state
+		}
+	}
+	return nil
+}
+
+func (ffs *FaultFS) Lock(name string) (io.Closer, error) {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	lock, err := ffs.VFS.Lock(name)
+	if err != nil {
+		return nil, err
+	}
+	ffs.locks = append(ffs.locks, lock)
+	return &faultFileLock{fs: ffs, lock: lock}, nil
+}
+
+// 判断这次写入是否需要触发故障
+func (ffs *FaultFS) writeFault() (fault bool, short bool) {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	if ffs.writeFaultAt == 0 {
+		return false, false
+	}
+	ffs.writeFaultAt--
+	return ffs.writeFaultAt == 0, ffs.shortWrite
+}
+
+// 判断这次持久化是否需要触发故障
+func (ffs *FaultFS) syncFault() bool {
+	ffs.mu.Lock()
+	defer ffs.mu.Unlock()
+	if ffs.syncFaultAt == 0 {
+		return false
+	}
+	ffs.syncFaultAt--
+	return ffs.syncFaultAt == 0
+}
+
+type faultFileLock struct {
+	fs   *FaultFS
+	lock io.Closer
+}
+
+func (l *faultFileLock) Close() error {
+	l.fs.mu.Lock()
+	defer l.fs.mu.Unlock()
+	for i, lock := range l.fs.locks {
+		if lock == l.lock {
+			l.fs.locks = append(l.fs.locks[:i], l.fs.locks[i+1:]...)
+			return lock.Close()
+		}
+	}
+	// 崩溃时已经释放
+	return nil
+}
+
+// 文件的持久化状态
+type faultFileState struct {
+	writeOff   int64 // 当前写入的位置
+	syncedOff  int64 // 上次持久化时写入的位置，之后写入的数据在崩溃时丢弃
+	syncedSize int64 // 上次持久化时的文件大小，包括预分配的空间
+}
+
+// 丢弃上次持久化之后写入的数据，只保留其中的前 keep 个字节，并恢复持久化时预分配的空间
+func (state *faultFileState) crash(ioManager IOManager, keep int64) error {
+	if unsynced := state.writeOff - state.syncedOff; keep > unsynced {
+		keep = unsynced
+	}
+	var torn []byte
+	if keep > 0 {
+		torn = make([]byte, keep)
+		if _, err := ioManager.Read(torn, state.syncedOff); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	size, err := ioManager.Size()
+	if err != nil {
+		return err
+	}
+	if size > state.syncedOff {
+		if err := ioManager.Truncate(state.syncedOff); err != nil {
+			return err
+		}
+	}
+	if len(torn) > 0 {
+		if _, err := ioManager.Write(torn); err != nil {
+			return err
+		}
+	}
+	if size, err = ioManager.Size(); err == nil && size < state.syncedSize {
+		err = ioManager.Truncate(state.syncedSize)
+	}
+	return err
+}
+
+type faultFile struct {
+	fs        *FaultFS
+	name      string
+	ioManager IOManager
+	crashed   bool // 只能在持有 fs.mu 时修改
+}
+
+func (f *faultFile) isCrashed() bool {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return f.crashed
+}
+
+func (f *faultFile) Read(b []byte, offset int64) (int, error) {
+	if f.isCrashed() {
+		return 0, ErrCrashed
+	}
+	return f.ioManager.Read(b, offset)
+}
+
+func (f *faultFile) Write(b []byte) (int, error) {
+	if f.isCrashed() {
+		return 0, ErrCrashed
+	}
+	fault, short := f.fs.writeFault()
+	if !fault {
+		n, err := f.ioManager.Write(b)
+		f.wrote(n)
+		return n, err
+	}
+	if !short {
+		return 0, ErrInjectedFault
+	}
+	n, err := f.ioManager.Write(b[:len(b)/2])
+	f.wrote(n)
+	if err != nil {
+		return n, err
+	}
+	return n, ErrInjectedFault
+}
+
+// 记录写入的位置
+func (f *faultFile) wrote(n int) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if state, ok := f.fs.synced[f.name]; ok && !f.crashed {
+		state.writeOff += int64(n)
+	}
+}
+
+func (f *faultFile) Sync() error {
+	if f.isCrashed() {
+		return ErrCrashed
+	}
+	if f.fs.syncFault() {
+		return ErrInjectedFault
+	}
+	if err := f.ioManager.Sync(); err != nil {
+		return err
+	}
+	size, err := f.ioManager.Size()
+	if err != nil {
+		return err
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if state, ok := f.fs.synced[f.name]; ok && !f.crashed {
+		state.syncedOff = state.writeOff
+		state.syncedSize = size
+	}
+	return nil
+}
+
+func (f *faultFile) Close() error {
+	f.fs.mu.Lock()
+	delete(f.fs.openFiles, f)
+	f.fs.mu.Unlock()
+	return f.ioManager.Close()
+}
+
+func (f *faultFile) Size() (int64, error) {
+	if f.isCrashed() {
+		return 0, ErrCrashed
+	}
+	return f.ioManager.Size()
+}
+
+// PhysicalSize 底层的 IOManager 没有实现 PhysicalSizer 时返回 Size
+func (f *faultFile) PhysicalSize() (int64, error) {
+	if f.isCrashed() {
+		return 0, ErrCrashed
+	}
+	if sizer, ok := f.ioManager.(PhysicalSizer); ok {
+		return sizer.PhysicalSize()
+	}
+	return f.ioManager.Size()
+}
+
+func (f *faultFile) Truncate(size int64) error {
+	if f.isCrashed() {
+		return ErrCrashed
+	}
+	if err := f.ioManager.Truncate(size); err != nil {
+		return err
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if state, ok := f.fs.synced[f.name]; ok && !f.crashed {
+		state.writeOff = size
+		if state.syncedOff > size {
+			state.syncedOff = size
+		}
+		if state.syncedSize > size {
+			state.syncedSize = size
+		}
+	}
+	return nil
+}
+
+// Preallocate 底层的 IOManager 不支持预分配时不做任何处理
+// 预分配的空间在持久化之前崩溃会被丢弃
+func (f *faultFile) Preallocate(size int64) error {
+	if f.isCrashed() {
+		return ErrCrashed
+	}
+	if preallocator, ok := f.ioManager.(Preallocator); ok {
+		return preallocator.Preallocate(size)
+	}
+	return nil
+}
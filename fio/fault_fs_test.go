@@ -0,0 +1,104 @@
+package fio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFaultFS_WriteFault(t *testing.T) {
+	fs := NewFaultFS(NewMemFS())
+	assert.Nil(t, fs.MkdirAll("/bitcask"))
+	fio, err := fs.OpenFile("/bitcask/a.data", StandardFIO)
+	assert.Nil(t, err)
+
+	fs.InjectWriteFault(2, true)
+	_, err = fio.Write([]byte("key-a"))
+	assert.Nil(t, err)
+	n, err := fio.Write([]byte("key-b"))
+	assert.Equal(t, ErrInjectedFault, err)
+	assert.Equal(t, 2, n)
+	size, _ := fio.Size()
+	assert.Equal(t, int64(7), size)
+
+	fs.InjectWriteFault(1, false)
+	n, err = fio.Write([]byte("key-c"))
+	assert.Equal(t, ErrInjectedFault, err)
+	assert.Equal(t, 0, n)
+
+	// 故障只触发一次
+	_, err = fio.Write([]byte("key-d"))
+	assert.Nil(t, err)
+
+	fs.InjectSyncFault(1)
+	assert.Equal(t, ErrInjectedFault, fio.Sync())
+	assert.Nil(t, fio.Sync())
+}
+
+func TestFaultFS_Crash(t *testing.T) {
+	fs := NewFaultFS(NewMemFS())
+	assert.Nil(t, fs.MkdirAll("/bitcask"))
+	lock, err := fs.Lock("/bitcask/flock")
+	assert.Nil(t, err)
+
+	fio, err := fs.OpenFile("/bitcask/a.data", StandardFIO)
+	assert.Nil(t, err)
+	_, err = fio.Write([]byte("key-a"))
+	assert.Nil(t, err)
+	assert.Nil(t, fio.Sync())
+	_, err = fio.Write([]byte("key-b"))
+	assert.Nil(t, err)
+
+	// 没有持久化过的文件崩溃之后为空
+	fio2, err := fs.OpenFile("/bitcask/b.data", StandardFIO)
+	assert.Nil(t, err)
+	_, err = fio2.Write([]byte("key-c"))
+	assert.Nil(t, err)
+	assert.Nil(t, fs.Rename("/bitcask/b.data", "/bitcask/c.data"))
+
+	fs.InjectSyncFault(1)
+	assert.Equal(t, ErrInjectedFault, fio2.Sync())
+
+	assert.Nil(t, fs.Crash())
+	_, err = fio.Write([]byte("key-d"))
+	assert.Equal(t, ErrCrashed, err)
+	assert.Nil(t, lock.Close())
+
+	// 崩溃之后文件锁已经释放
+	lock, err = fs.Lock("/bitcask/flock")
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Close())
+
+	fio, err = fs.OpenFile("/bitcask/a.data", StandardFIO)
+	assert.Nil(t, err)
+	size, _ := fio.Size()
+	assert.Equal(t, int64(5), size)
+	info, err := fs.Stat("/bitcask/c.data")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+}
+
+func TestFaultFS_TornCrash(t *testing.T) {
+	fs := NewFaultFS(NewMemFS())
+	assert.Nil(t, fs.MkdirAll("/bitcask"))
+	fio, err := fs.OpenFile("/bitcask/a.data", StandardFIO)
+	assert.Nil(t, err)
+	assert.Nil(t, fio.(Preallocator).Preallocate(16))
+	_, err = fio.Write([]byte("key-a"))
+	assert.Nil(t, err)
+	assert.Nil(t, fio.Sync())
+
+	// 持久化之后预分配的空间不会丢失
+	assert.Nil(t, fio.(Preallocator).Preallocate(32))
+	_, err = fio.Write([]byte("key-b"))
+	assert.Nil(t, err)
+	assert.Nil(t, fs.TornCrash(2))
+
+	fio, err = fs.OpenFile("/bitcask/a.data", StandardFIO)
+	assert.Nil(t, err)
+	size, _ := fio.Size()
+	assert.Equal(t, int64(16), size)
+	b := make([]byte, 16)
+	_, err = fio.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, append([]byte("key-ake"), 0, 0, 0, 0, 0, 0, 0, 0, 0), b)
+}
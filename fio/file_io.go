@@ -1,23 +1,47 @@
 package fio
 
-import "os"
+import (
+	"os"
+	"syscall"
+)
 
 // FileIO 标准系统文件 IO
 type FileIO struct {
-	fd *os.File // 系统文件描述符
+	fd       *os.File // 系统文件描述符
+	dsync    bool     // 是否使用 O_DSYNC 打开
+	writeOff int64    // 下一次写入的位置，预分配之后文件大小会超过这个位置
 }
 
 // NewFileIOManager 初始化标准文件 IO
 func NewFileIOManager(fileName string) (*FileIO, error) {
+	return newFileIO(fileName, 0)
+}
+
+// NewDSyncIOManager 初始化使用 O_DSYNC 打开的文件 IO，每次写入返回时数据已经持久化
+func NewDSyncIOManager(fileName string) (*FileIO, error) {
+	fio, err := newFileIO(fileName, syscall.O_DSYNC)
+	if err != nil {
+		return nil, err
+	}
+	fio.dsync = true
+	return fio, nil
+}
+
+func newFileIO(fileName string, flag int) (*FileIO, error) {
 	fd, err := os.OpenFile(
 		fileName,
-		os.O_CREATE|os.O_RDWR|os.O_APPEND,
+		os.O_CREATE|os.O_RDWR|flag,
 		DataFilePerm,
 	)
 	if err != nil {
 		return nil, err
 	}
-	return &FileIO{fd: fd}, nil
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	return &FileIO{fd: fd, writeOff: stat.Size()}, nil
 }
 
 func (fio *FileIO) Read(b []byte, offset int64) (int, error) {
@@ -25,10 +49,16 @@ func (fio *FileIO) Read(b []byte, offset int64) (int, error) {
 }
 
 func (fio *FileIO) Write(b []byte) (int, error) {
-	return fio.fd.Write(b)
+	n, err := fio.fd.WriteAt(b, fio.writeOff)
+	fio.writeOff += int64(n)
+	return n, err
 }
 
 func (fio *FileIO) Sync() error {
+	// O_DSYNC 打开的文件每次写入都已经持久化
+	if fio.dsync {
+		return nil
+	}
 	return fio.fd.Sync()
 }
 
@@ -36,6 +66,19 @@ func (fio *FileIO) Close() error {
 	return fio.fd.Close()
 }
 
+func (fio *FileIO) Truncate(size int64) error {
+	if err := fio.fd.Truncate(size); err != nil {
+		return err
+	}
+	fio.writeOff = size
+	return nil
+}
+
+// Preallocate 预分配磁盘空间，文件大小扩大到 size，写入位置不变
+func (fio *FileIO) Preallocate(size int64) error {
+	return preallocate(fio.fd, size)
+}
+
 func (fio *FileIO) Size() (int64, error) {
 	stat, err := fio.fd.Stat()
 	if err != nil {
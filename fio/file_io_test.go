@@ -91,3 +91,21 @@ func TestFileIO_Close(t *testing.T) {
 	err = fio.Close()
 	assert.Nil(t, err)
 }
+
+func TestDSyncIO(t *testing.T) {
+	path := filepath.Join("/tmp", "dsync.data")
+	fio, err := NewDSyncIOManager(path)
+	defer destroyFile(path)
+	assert.Nil(t, err)
+
+	n, err := fio.Write([]byte("key-a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	assert.Nil(t, fio.Sync())
+
+	b := make([]byte, 5)
+	_, err = fio.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("key-a"), b)
+	assert.Nil(t, fio.Close())
+}
@@ -10,9 +10,15 @@ const (
 
 	// MemoryMap 内存文件映射
 	MemoryMap
+
+	// DirectIO 使用 O_DIRECT 打开文件，读写绕过页缓存
+	DirectIO
+
+	// DSyncIO 使用 O_DSYNC 打开文件，每次写入都同步持久化，Sync 不需要再做任何操作
+	DSyncIO
 )
 
-// IOManager 抽象 IO 管理接口，可以接入不同的 IO 类型，目前支持标准文件 IO
+// IOManager 抽象 IO 管理接口，可以接入不同的 IO 类型，目前支持标准文件 IO、内存文件映射、直接 IO 和 O_DSYNC 文件 IO
 type IOManager interface {
 	// Read 从文件的给定位置读取对应的数据
 	Read([]byte, int64) (int, error)
@@ -28,15 +34,36 @@ type IOManager interface {
 
 	// Size 获取到文件大小
 	Size() (int64, error)
+
+	// Truncate 将文件截断到指定的大小
+	Truncate(size int64) error
+}
+
+// Preallocator 支持预分配磁盘空间的 IOManager
+// 预分配之后文件末尾是 0，读取到全 0 的 header 时按照文件末尾处理
+type Preallocator interface {
+	// Preallocate 预分配磁盘空间，保证文件大小不小于 size，不改变写入的位置
+	Preallocate(size int64) error
+}
+
+// PhysicalSizer 磁盘上的文件大小可能大于 Size 的 IOManager，例如预分配的空间和按块补齐的部分
+// 没有实现这个接口的 IOManager，Size 返回的就是文件在磁盘上的大小
+type PhysicalSizer interface {
+	// PhysicalSize 获取文件在磁盘上的大小
+	PhysicalSize() (int64, error)
 }
 
-// NewIOManager 初始化 IOManager，目前只支持标准 FileIO
+// NewIOManager 初始化 IOManager
 func NewIOManager(fileName string, ioType FileIOType) (IOManager, error) {
 	switch ioType {
 	case StandardFIO:
 		return NewFileIOManager(fileName)
 	case MemoryMap:
 		return NewMMapIOManager(fileName)
+	case DirectIO:
+		return NewDirectIOManager(fileName)
+	case DSyncIO:
+		return NewDSyncIOManager(fileName)
 	default:
 		panic("unsupported io type")
 	}
@@ -0,0 +1,329 @@
+package fio
+
+import (
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS 内存文件系统，所有的数据都保存在内存中，用于测试和临时的数据库
+// 同一个 MemFS 中的文件在关闭之后仍然存在，可以重新打开数据库
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memFile // 文件路径到文件内容
+	dirs  map[string]bool     // 所有的目录
+	locks map[string]bool     // 已经加锁的文件
+}
+
+type memFile struct {
+	mu      sync.RWMutex
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemFS 初始化内存文件系统
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: make(map[string]*memFile),
+		dirs:  map[string]bool{string(filepath.Separator): true, ".": true},
+		locks: make(map[string]bool),
+	}
+}
+
+func (mfs *MemFS) OpenFile(name string, _ FileIOType) (IOManager, error) {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	name = filepath.Clean(name)
+	if mfs.dirs[name] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if !mfs.dirs[filepath.Dir(name)] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	file, ok := mfs.files[name]
+	if !ok {
+		file = &memFile{modTime: time.Now()}
+		mfs.files[name] = file
+	}
+	file.mu.RLock()
+	defer file.mu.RUnlock()
+	return &MemFileIO{file: file, writeOff: int64(len(file.data))}, nil
+}
+
+func (mfs *MemFS) ReadDir(name string) ([]os.DirEntry, error) {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	name = filepath.Clean(name)
+	if !mfs.dirs[name] {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	var entries []os.DirEntry
+	for path := range mfs.dirs {
+		if path != name && filepath.Dir(path) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(mfs.stat(path)))
+		}
+	}
+	for path := range mfs.files {
+		if filepath.Dir(path) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(mfs.stat(path)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (mfs *MemFS) Stat(name string) (os.FileInfo, error) {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	name = filepath.Clean(name)
+	if info := mfs.stat(name); info != nil {
+		return info, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (mfs *MemFS) stat(name string) *memFileInfo {
+	if mfs.dirs[name] {
+		return &memFileInfo{name: filepath.Base(name), isDir: true}
+	}
+	if file, ok := mfs.files[name]; ok {
+		file.mu.RLock()
+		defer file.mu.RUnlock()
+		return &memFileInfo{name: filepath.Base(name), size: int64(len(file.data)), modTime: file.modTime}
+	}
+	return nil
+}
+
+func (mfs *MemFS) MkdirAll(path string) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	for path = filepath.Clean(path); !mfs.dirs[path]; path = filepath.Dir(path) {
+		if _, ok := mfs.files[path]; ok {
+			return &os.PathError{Op: "mkdir", Path: path, Err: fs.ErrExist}
+		}
+		mfs.dirs[path] = true
+	}
+	return nil
+}
+
+func (mfs *MemFS) Remove(name string) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := mfs.files[name]; ok {
+		delete(mfs.files, name)
+		return nil
+	}
+	if !mfs.dirs[name] {
+		return &os.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	for path := range mfs.files {
+		if isSubPath(name, path) {
+			return &os.PathError{Op: "remove", Path: name, Err: fs.ErrExist}
+		}
+	}
+	for path := range mfs.dirs {
+		if isSubPath(name, path) {
+			return &os.PathError{Op: "remove", Path: name, Err: fs.ErrExist}
+		}
+	}
+	delete(mfs.dirs, name)
+	return nil
+}
+
+func (mfs *MemFS) RemoveAll(path string) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	path = filepath.Clean(path)
+	delete(mfs.files, path)
+	delete(mfs.dirs, path)
+	for name := range mfs.files {
+		if isSubPath(path, name) {
+			delete(mfs.files, name)
+		}
+	}
+	for name := range mfs.dirs {
+		if isSubPath(path, name) {
+			delete(mfs.dirs, name)
+		}
+	}
+	return nil
+}
+
+func (mfs *MemFS) Rename(oldPath, newPath string) error {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	if !mfs.dirs[filepath.Dir(newPath)] {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrNotExist}
+	}
+	if file, ok := mfs.files[oldPath]; ok {
+		if mfs.dirs[newPath] {
+			return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrExist}
+		}
+		delete(mfs.files, oldPath)
+		mfs.files[newPath] = file
+		return nil
+	}
+	if !mfs.dirs[oldPath] {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrNotExist}
+	}
+	if _, ok := mfs.files[newPath]; ok || mfs.dirs[newPath] {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fs.ErrExist}
+	}
+	// 移动目录及其中所有的文件
+	for name, file := range mfs.files {
+		if isSubPath(oldPath, name) {
+			delete(mfs.files, name)
+			mfs.files[newPath+strings.TrimPrefix(name, oldPath)] = file
+		}
+	}
+	for name := range mfs.dirs {
+		if name == oldPath || isSubPath(oldPath, name) {
+			delete(mfs.dirs, name)
+			mfs.dirs[newPath+strings.TrimPrefix(name, oldPath)] = true
+		}
+	}
+	return nil
+}
+
+func (mfs *MemFS) Lock(name string) (io.Closer, error) {
+	mfs.mu.Lock()
+	defer mfs.mu.Unlock()
+	name = filepath.Clean(name)
+	if mfs.locks[name] {
+		return nil, ErrFileLocked
+	}
+	if !mfs.dirs[filepath.Dir(name)] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	// 和文件锁一样创建出锁文件
+	if _, ok := mfs.files[name]; !ok {
+		mfs.files[name] = &memFile{modTime: time.Now()}
+	}
+	mfs.locks[name] = true
+	return &memFileLock{fs: mfs, name: name}, nil
+}
+
+// AvailableSpace 内存文件系统不限制使用的空间
+func (mfs *MemFS) AvailableSpace(string) (uint64, error) {
+	return math.MaxUint64, nil
+}
+
+func isSubPath(dir, path string) bool {
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+type memFileLock struct {
+	fs   *MemFS
+	name string
+	once sync.Once
+}
+
+func (l *memFileLock) Close() error {
+	l.once.Do(func() {
+		l.fs.mu.Lock()
+		delete(l.fs.locks, l.name)
+		l.fs.mu.Unlock()
+	})
+	return nil
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	isDir   bool
+	modTime time.Time
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.isDir }
+func (fi *memFileInfo) Sys() any           { return nil }
+
+func (fi *memFileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return os.ModeDir | os.ModePerm
+	}
+	return DataFilePerm
+}
+
+// MemFileIO 内存文件 IO，读写 MemFS 中的文件
+type MemFileIO struct {
+	file     *memFile
+	writeOff int64 // 下一次写入的位置，预分配之后文件大小会超过这个位置
+}
+
+func (mio *MemFileIO) Read(b []byte, offset int64) (int, error) {
+	mio.file.mu.RLock()
+	defer mio.file.mu.RUnlock()
+	if offset >= int64(len(mio.file.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, mio.file.data[offset:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (mio *MemFileIO) Write(b []byte) (int, error) {
+	mio.file.mu.Lock()
+	defer mio.file.mu.Unlock()
+	mio.file.grow(mio.writeOff + int64(len(b)))
+	copy(mio.file.data[mio.writeOff:], b)
+	mio.writeOff += int64(len(b))
+	mio.file.modTime = time.Now()
+	return len(b), nil
+}
+
+func (mio *MemFileIO) Sync() error {
+	return nil
+}
+
+func (mio *MemFileIO) Close() error {
+	return nil
+}
+
+func (mio *MemFileIO) Size() (int64, error) {
+	mio.file.mu.RLock()
+	defer mio.file.mu.RUnlock()
+	return int64(len(mio.file.data)), nil
+}
+
+func (mio *MemFileIO) Truncate(size int64) error {
+	mio.file.mu.Lock()
+	defer mio.file.mu.Unlock()
+	if size <= int64(len(mio.file.data)) {
+		mio.file.data = mio.file.data[:size]
+	} else {
+		mio.file.grow(size)
+	}
+	mio.writeOff = size
+	mio.file.modTime = time.Now()
+	return nil
+}
+
+// Preallocate 文件大小扩大到 size，扩大的部分为 0，写入位置不变
+func (mio *MemFileIO) Preallocate(size int64) error {
+	mio.file.mu.Lock()
+	defer mio.file.mu.Unlock()
+	mio.file.grow(size)
+	return nil
+}
+
+// 文件大小不足 size 时用 0 填充，需要持有 mu
+func (file *memFile) grow(size int64) {
+	if n := size - int64(len(file.data)); n > 0 {
+		file.data = append(file.data, make([]byte, n)...)
+	}
+}
@@ -0,0 +1,121 @@
+package fio
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestMemFS_OpenFile(t *testing.T) {
+	fs := NewMemFS()
+	_, err := fs.OpenFile("/bitcask/a.data", StandardFIO)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, fs.MkdirAll("/bitcask"))
+	mio, err := fs.OpenFile("/bitcask/a.data", StandardFIO)
+	assert.Nil(t, err)
+	_, err = mio.Write([]byte("key-a"))
+	assert.Nil(t, err)
+	_, err = mio.Write([]byte("key-b"))
+	assert.Nil(t, err)
+	assert.Nil(t, mio.Close())
+
+	// 关闭之后重新打开，数据仍然存在
+	mio, err = fs.OpenFile("/bitcask/a.data", MemoryMap)
+	assert.Nil(t, err)
+	size, err := mio.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), size)
+	b := make([]byte, 5)
+	n, err := mio.Read(b, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, "key-b", string(b[:n]))
+	n, err = mio.Read(b, 8)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "-b", string(b[:n]))
+
+	assert.Nil(t, mio.Truncate(3))
+	size, _ = mio.Size()
+	assert.Equal(t, int64(3), size)
+	assert.Nil(t, mio.Truncate(8))
+	n, _ = mio.Read(b, 3)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0}, b[:n])
+}
+
+func TestMemFS_Preallocate(t *testing.T) {
+	fs := NewMemFS()
+	assert.Nil(t, fs.MkdirAll("/bitcask"))
+	mio, err := fs.OpenFile("/bitcask/a.data", StandardFIO)
+	assert.Nil(t, err)
+	_, err = mio.Write([]byte("key-a"))
+	assert.Nil(t, err)
+
+	// 预分配之后文件变大，写入位置不变
+	assert.Nil(t, mio.(Preallocator).Preallocate(16))
+	size, _ := mio.Size()
+	assert.Equal(t, int64(16), size)
+	_, err = mio.Write([]byte("key-b"))
+	assert.Nil(t, err)
+	size, _ = mio.Size()
+	assert.Equal(t, int64(16), size)
+	b := make([]byte, 16)
+	_, err = mio.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, append([]byte("key-akey-b"), 0, 0, 0, 0, 0, 0), b)
+}
+
+func TestMemFS_Dir(t *testing.T) {
+	fs := NewMemFS()
+	assert.Nil(t, fs.MkdirAll("/bitcask/sub"))
+	for _, name := range []string{"/bitcask/b.data", "/bitcask/a.data", "/bitcask/sub/c.data"} {
+		mio, err := fs.OpenFile(name, StandardFIO)
+		assert.Nil(t, err)
+		_, err = mio.Write([]byte("value"))
+		assert.Nil(t, err)
+	}
+
+	entries, err := fs.ReadDir("/bitcask")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(entries))
+	assert.Equal(t, "a.data", entries[0].Name())
+	assert.Equal(t, "sub", entries[2].Name())
+	assert.True(t, entries[2].IsDir())
+	size, err := DirSize(fs, "/bitcask")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15), size)
+
+	// 非空目录不能直接删除
+	assert.NotNil(t, fs.Remove("/bitcask/sub"))
+	assert.Nil(t, fs.Rename("/bitcask/sub", "/bitcask/moved"))
+	info, err := fs.Stat("/bitcask/moved/c.data")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), info.Size())
+	_, err = fs.Stat("/bitcask/sub/c.data")
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, CopyDir(fs, "/bitcask", "/backup", []string{"b.data"}))
+	entries, err = fs.ReadDir("/backup")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+
+	assert.Nil(t, fs.RemoveAll("/bitcask"))
+	_, err = fs.Stat("/bitcask/a.data")
+	assert.True(t, os.IsNotExist(err))
+	_, err = fs.ReadDir("/bitcask/moved")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMemFS_Lock(t *testing.T) {
+	fs := NewMemFS()
+	assert.Nil(t, fs.MkdirAll("/bitcask"))
+	lock, err := fs.Lock("/bitcask/flock")
+	assert.Nil(t, err)
+	_, err = fs.Lock("/bitcask/flock")
+	assert.Equal(t, ErrFileLocked, err)
+
+	assert.Nil(t, lock.Close())
+	lock, err = fs.Lock("/bitcask/flock")
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Close())
+}
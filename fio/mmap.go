@@ -1,44 +1,160 @@
 package fio
 
 import (
-	"golang.org/x/exp/mmap"
+	"golang.org/x/sys/unix"
+	"io"
 	"os"
+	"sync"
 )
 
-// MMap IO，内存文件映射
+// 映射区域每次扩容的大小，文件按照这个大小预分配
+var mmapChunkSize int64 = 16 * 1024 * 1024
+
+// MMap IO，内存文件映射，支持读写
+// 写入时按照 mmapChunkSize 预分配文件并扩大映射区域，关闭时将文件截断到实际写入的大小
 type MMap struct {
-	readerAt *mmap.ReaderAt
+	mu     sync.RWMutex
+	fd     *os.File
+	data   []byte // 映射区域，长度即文件在磁盘上的大小
+	size   int64  // 实际写入的数据大小
+	resize bool   // 上次持久化之后文件大小是否发生了变化
 }
 
 // NewMMapIOManager 初始化 MMap IO
 func NewMMapIOManager(fileName string) (*MMap, error) {
-	_, err := os.OpenFile(fileName, os.O_CREATE, DataFilePerm)
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DataFilePerm)
 	if err != nil {
 		return nil, err
 	}
-	readerAt, err := mmap.Open(fileName)
+	stat, err := fd.Stat()
 	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	mmap := &MMap{fd: fd, size: stat.Size()}
+	if err := mmap.remap(stat.Size()); err != nil {
+		_ = fd.Close()
 		return nil, err
 	}
-	return &MMap{readerAt: readerAt}, nil
+	return mmap, nil
 }
 
 func (mmap *MMap) Read(b []byte, offset int64) (int, error) {
-	return mmap.readerAt.ReadAt(b, offset)
+	mmap.mu.RLock()
+	defer mmap.mu.RUnlock()
+	if offset >= mmap.size {
+		return 0, io.EOF
+	}
+	n := copy(b, mmap.data[offset:mmap.size])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
 }
 
-func (mmap *MMap) Write([]byte) (int, error) {
-	panic("not implemented")
+func (mmap *MMap) Write(b []byte) (int, error) {
+	mmap.mu.Lock()
+	defer mmap.mu.Unlock()
+	if end := mmap.size + int64(len(b)); end > int64(len(mmap.data)) {
+		// 按照块的大小扩大文件和映射区域
+		capacity := (end + mmapChunkSize - 1) / mmapChunkSize * mmapChunkSize
+		if err := mmap.remap(capacity); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(mmap.data[mmap.size:], b)
+	mmap.size += int64(n)
+	return n, nil
 }
 
 func (mmap *MMap) Sync() error {
-	panic("not implemented")
+	mmap.mu.Lock()
+	defer mmap.mu.Unlock()
+	if mmap.size > 0 {
+		if err := unix.Msync(mmap.data[:mmap.size], unix.MS_SYNC); err != nil {
+			return err
+		}
+	}
+	// 文件大小的变化需要通过 fsync 持久化
+	if mmap.resize {
+		if err := mmap.fd.Sync(); err != nil {
+			return err
+		}
+		mmap.resize = false
+	}
+	return nil
 }
 
 func (mmap *MMap) Close() error {
-	return mmap.readerAt.Close()
+	mmap.mu.Lock()
+	defer mmap.mu.Unlock()
+	if err := mmap.unmap(); err != nil {
+		return err
+	}
+	// 去掉预分配的部分
+	if err := mmap.fd.Truncate(mmap.size); err != nil {
+		return err
+	}
+	return mmap.fd.Close()
 }
 
 func (mmap *MMap) Size() (int64, error) {
-	return int64(mmap.readerAt.Len()), nil
+	mmap.mu.RLock()
+	defer mmap.mu.RUnlock()
+	return mmap.size, nil
+}
+
+// PhysicalSize 文件在磁盘上的大小，包括按块预分配的部分
+func (mmap *MMap) PhysicalSize() (int64, error) {
+	mmap.mu.RLock()
+	defer mmap.mu.RUnlock()
+	return int64(len(mmap.data)), nil
+}
+
+// Truncate 截断文件，丢弃 size 之后的数据
+func (mmap *MMap) Truncate(size int64) error {
+	mmap.mu.Lock()
+	defer mmap.mu.Unlock()
+	if err := mmap.remap(size); err != nil {
+		return err
+	}
+	mmap.size = size
+	return nil
+}
+
+// 将文件大小调整为 capacity，并重新映射整个文件
+func (mmap *MMap) remap(capacity int64) error {
+	if err := mmap.unmap(); err != nil {
+		return err
+	}
+	stat, err := mmap.fd.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() != capacity {
+		if err := mmap.fd.Truncate(capacity); err != nil {
+			return err
+		}
+		mmap.resize = true
+	}
+	if capacity == 0 {
+		return nil
+	}
+	data, err := unix.Mmap(int(mmap.fd.Fd()), 0, int(capacity), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	mmap.data = data
+	return nil
+}
+
+func (mmap *MMap) unmap() error {
+	if mmap.data == nil {
+		return nil
+	}
+	if err := unix.Munmap(mmap.data); err != nil {
+		return err
+	}
+	mmap.data = nil
+	return nil
 }
@@ -3,6 +3,7 @@ package fio
 import (
 	"github.com/stretchr/testify/assert"
 	"io"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -41,3 +42,67 @@ func TestMMap_Read(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 2, n2)
 }
+
+func TestMMap_Write(t *testing.T) {
+	path := filepath.Join("/tmp", "mmap-b.data")
+	defer destroyFile(path)
+
+	chunkSize := mmapChunkSize
+	mmapChunkSize = 16
+	defer func() { mmapChunkSize = chunkSize }()
+
+	mmapIO, err := NewMMapIOManager(path)
+	assert.Nil(t, err)
+
+	// 写入时按照块的大小预分配文件
+	n, err := mmapIO.Write([]byte("key-a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	_, err = mmapIO.Write([]byte("key-bbbbbbbbbbbbbbbbb"))
+	assert.Nil(t, err)
+	size, err := mmapIO.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(26), size)
+	stat, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(32), stat.Size())
+	physicalSize, err := mmapIO.PhysicalSize()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(32), physicalSize)
+
+	b := make([]byte, 21)
+	n, err = mmapIO.Read(b, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, 21, n)
+	assert.Equal(t, []byte("key-bbbbbbbbbbbbbbbbb"), b)
+	_, err = mmapIO.Read(b, 10)
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, mmapIO.Sync())
+
+	// 关闭时截断到实际写入的大小
+	assert.Nil(t, mmapIO.Close())
+	stat, err = os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(26), stat.Size())
+
+	// 重新打开之后继续写入
+	mmapIO, err = NewMMapIOManager(path)
+	assert.Nil(t, err)
+	_, err = mmapIO.Write([]byte("c"))
+	assert.Nil(t, err)
+	b = make([]byte, 6)
+	_, err = mmapIO.Read(b, 21)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bbbbbc"), b)
+
+	assert.Nil(t, mmapIO.Truncate(5))
+	size, err = mmapIO.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), size)
+	_, err = mmapIO.Write([]byte("d"))
+	assert.Nil(t, err)
+	assert.Nil(t, mmapIO.Close())
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("key-ad"), content)
+}
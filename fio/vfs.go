@@ -0,0 +1,196 @@
+package fio
+
+import (
+	"bitcask-go/utils"
+	"errors"
+	"github.com/gofrs/flock"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var ErrFileLocked = errors.New("the file is locked by another process")
+
+// VFS 文件系统抽象，数据目录中的文件和目录操作都通过它完成
+type VFS interface {
+	// OpenFile 以指定的 IO 类型打开文件，文件不存在时创建
+	OpenFile(name string, ioType FileIOType) (IOManager, error)
+
+	// ReadDir 读取目录中的文件和子目录，按照文件名排序
+	ReadDir(name string) ([]os.DirEntry, error)
+
+	// Stat 获取文件信息，文件不存在时返回的错误满足 os.IsNotExist
+	Stat(name string) (os.FileInfo, error)
+
+	// MkdirAll 创建目录，以及所有不存在的上级目录
+	MkdirAll(path string) error
+
+	// Remove 删除文件或者空目录
+	Remove(name string) error
+
+	// RemoveAll 删除目录及其中的所有文件
+	RemoveAll(path string) error
+
+	// Rename 重命名文件或者目录
+	Rename(oldPath, newPath string) error
+
+	// Lock 对文件加锁，保证多个实例之间的互斥，已经被锁住时返回 ErrFileLocked
+	// 调用返回值的 Close 方法释放锁
+	Lock(name string) (io.Closer, error)
+
+	// AvailableSpace 获取路径所在存储的剩余可用空间
+	AvailableSpace(path string) (uint64, error)
+}
+
+// OSFS 操作系统的文件系统
+type OSFS struct{}
+
+func (OSFS) OpenFile(name string, ioType FileIOType) (IOManager, error) {
+	return NewIOManager(name, ioType)
+}
+
+func (OSFS) ReadDir(name string) ([]os.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OSFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFS) MkdirAll(path string) error {
+	return os.MkdirAll(path, os.ModePerm)
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (OSFS) Rename(oldPath, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (OSFS) Lock(name string) (io.Closer, error) {
+	fileLock := flock.New(name)
+	hold, err := fileLock.TryLock()
+	if err != nil {
+		return nil, err
+	}
+	if !hold {
+		return nil, ErrFileLocked
+	}
+	return osFileLock{fileLock}, nil
+}
+
+func (OSFS) AvailableSpace(path string) (uint64, error) {
+	return utils.AvailableDiskSizeOf(path)
+}
+
+type osFileLock struct {
+	*flock.Flock
+}
+
+func (l osFileLock) Close() error {
+	return l.Unlock()
+}
+
+// DirSize 获取目录中所有文件的大小之和
+func DirSize(fs VFS, dirPath string) (int64, error) {
+	entries, err := fs.ReadDir(dirPath)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, entry := range entries {
+		path := filepath.Join(dirPath, entry.Name())
+		if entry.IsDir() {
+			n, err := DirSize(fs, path)
+			if err != nil {
+				return 0, err
+			}
+			size += n
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return 0, err
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
+
+// CopyDir 拷贝目录，名称匹配 exclude 中任意一个模式的文件和目录会被跳过
+func CopyDir(fs VFS, src, dest string, exclude []string) error {
+	if err := fs.MkdirAll(dest); err != nil {
+		return err
+	}
+	entries, err := fs.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		excluded, err := matchAny(exclude, entry.Name())
+		if err != nil {
+			return err
+		}
+		if excluded {
+			continue
+		}
+		srcPath := filepath.Join(src, entry.Name())
+		destPath := filepath.Join(dest, entry.Name())
+		if entry.IsDir() {
+			err = CopyDir(fs, srcPath, destPath, exclude)
+		} else {
+			err = copyFile(fs, srcPath, destPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, pattern := range patterns {
+		matched, err := filepath.Match(pattern, name)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+func copyFile(fs VFS, src, dest string) error {
+	srcFile, err := fs.OpenFile(src, StandardFIO)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	size, err := srcFile.Size()
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, size)
+	if _, err := srcFile.Read(buf, 0); err != nil && err != io.EOF {
+		return err
+	}
+
+	destFile, err := fs.OpenFile(dest, StandardFIO)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+	// 目标文件已经存在时覆盖原有的内容
+	if err := destFile.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := destFile.Write(buf); err != nil {
+		return err
+	}
+	return destFile.Sync()
+}
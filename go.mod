@@ -9,7 +9,7 @@ require (
 	github.com/stretchr/testify v1.8.2
 	github.com/tidwall/redcon v1.6.2
 	go.etcd.io/bbolt v1.3.7
-	golang.org/x/exp v0.0.0-20230321023759-10a507213a29
+	golang.org/x/sys v0.4.0
 )
 
 require (
@@ -17,6 +17,5 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/tidwall/btree v1.1.0 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
-	golang.org/x/sys v0.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -2,21 +2,26 @@ package main
 
 import (
 	bitcask "bitcask-go"
+	"bitcask-go/fio"
+	"bitcask-go/metrics"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 )
 
 var db *bitcask.DB
 
+var promMetrics = metrics.NewPrometheus()
+
 func init() {
 	// 初始化 DB 实例
 	var err error
 	options := bitcask.DefaultOptions
-	dir, _ := os.MkdirTemp("", "bitcask-go-http")
-	options.DirPath = dir
+	// 数据只保存在内存中，进程退出之后不会在磁盘上留下临时目录
+	options.DirPath = "/bitcask-go-http"
+	options.FS = fio.NewMemFS()
+	options.Metrics = promMetrics
 	db, err = bitcask.Open(options)
 	if err != nil {
 		panic(fmt.Sprintf("failed to open db: %v", err))
@@ -116,6 +121,7 @@ func main() {
 	http.HandleFunc("/bitcask/delete", handleDelete)
 	http.HandleFunc("/bitcask/listkeys", handleListKeys)
 	http.HandleFunc("/bitcask/stat", handleStat)
+	http.Handle("/metrics", promMetrics)
 
 	// 启动 HTTP 服务
 	_ = http.ListenAndServe("localhost:8080", nil)
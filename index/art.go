@@ -2,9 +2,7 @@ package index
 
 import (
 	"bitcask-go/data"
-	"bytes"
 	goart "github.com/plar/go-adaptive-radix-tree"
-	"sort"
 	"sync"
 )
 
@@ -53,6 +51,30 @@ func (art *AdaptiveRadixTree) Delete(key []byte) (*data.LogRecordPos, bool) {
 	return oldValue.(*data.LogRecordPos), deleted
 }
 
+func (art *AdaptiveRadixTree) PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	oldPos := make([]*data.LogRecordPos, len(keys))
+	art.lock.Lock()
+	defer art.lock.Unlock()
+	for i, key := range keys {
+		if oldValue, _ := art.tree.Insert(key, positions[i]); oldValue != nil {
+			oldPos[i] = oldValue.(*data.LogRecordPos)
+		}
+	}
+	return oldPos
+}
+
+func (art *AdaptiveRadixTree) DeleteBatch(keys [][]byte) []*data.LogRecordPos {
+	oldPos := make([]*data.LogRecordPos, len(keys))
+	art.lock.Lock()
+	defer art.lock.Unlock()
+	for i, key := range keys {
+		if oldValue, _ := art.tree.Delete(key); oldValue != nil {
+			oldPos[i] = oldValue.(*data.LogRecordPos)
+		}
+	}
+	return oldPos
+}
+
 func (art *AdaptiveRadixTree) Size() int {
 	art.lock.RLock()
 	size := art.tree.Size()
@@ -60,84 +82,22 @@ func (art *AdaptiveRadixTree) Size() int {
 	return size
 }
 
+// Iterator 加锁取出所有的数据，遍历的是创建迭代器时的快照
+// 底层库没有暴露树的内部节点，也不支持 seek 和反向遍历，无法在树上增量遍历，因此仍然复制整个索引
 func (art *AdaptiveRadixTree) Iterator(reverse bool) Iterator {
 	art.lock.RLock()
 	defer art.lock.RUnlock()
-	return newARTIterator(art.tree, reverse)
-}
-
-func (art *AdaptiveRadixTree) Close() error {
-	return nil
-}
 
-// Art 索引迭代器
-type artIterator struct {
-	currIndex int     // 当前遍历的下标位置
-	reverse   bool    // 是否是反向遍历
-	values    []*Item // key+位置索引信息
-}
-
-func newARTIterator(tree goart.Tree, reverse bool) *artIterator {
-	var idx int
-	if reverse {
-		idx = tree.Size() - 1
-	}
-	values := make([]*Item, tree.Size())
-	saveValues := func(node goart.Node) bool {
-		item := &Item{
-			key: node.Key(),
-			pos: node.Value().(*data.LogRecordPos),
-		}
-		values[idx] = item
-		if reverse {
-			idx--
-		} else {
-			idx++
-		}
+	keys := make([][]byte, 0, art.tree.Size())
+	positions := make([]*data.LogRecordPos, 0, art.tree.Size())
+	art.tree.ForEach(func(node goart.Node) bool {
+		keys = append(keys, node.Key())
+		positions = append(positions, node.Value().(*data.LogRecordPos))
 		return true
-	}
-
-	tree.ForEach(saveValues)
-
-	return &artIterator{
-		currIndex: 0,
-		reverse:   reverse,
-		values:    values,
-	}
-}
-
-func (ai *artIterator) Rewind() {
-	ai.currIndex = 0
+	})
+	return NewSliceIterator(keys, positions, reverse, BytewiseComparator)
 }
 
-func (ai *artIterator) Seek(key []byte) {
-	if ai.reverse {
-		ai.currIndex = sort.Search(len(ai.values), func(i int) bool {
-			return bytes.Compare(ai.values[i].key, key) <= 0
-		})
-	} else {
-		ai.currIndex = sort.Search(len(ai.values), func(i int) bool {
-			return bytes.Compare(ai.values[i].key, key) >= 0
-		})
-	}
-}
-
-func (ai *artIterator) Next() {
-	ai.currIndex += 1
-}
-
-func (ai *artIterator) Valid() bool {
-	return ai.currIndex < len(ai.values)
-}
-
-func (ai *artIterator) Key() []byte {
-	return ai.values[ai.currIndex].key
-}
-
-func (ai *artIterator) Value() *data.LogRecordPos {
-	return ai.values[ai.currIndex].pos
-}
-
-func (ai *artIterator) Close() {
-	ai.values = nil
+func (art *AdaptiveRadixTree) Close() error {
+	return nil
 }
@@ -2,6 +2,7 @@ package index
 
 import (
 	"bitcask-go/data"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -76,3 +77,36 @@ func TestAdaptiveRadixTree_Iterator(t *testing.T) {
 		assert.NotNil(t, iter.Value())
 	}
 }
+
+func TestAdaptiveRadixTree_IteratorSnapshot(t *testing.T) {
+	art := NewART()
+	for i := 0; i < 1000; i += 2 {
+		art.Put([]byte(fmt.Sprintf("key-%04d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	// 遍历的是创建迭代器时的快照，之后的修改不可见
+	var keys []string
+	iter := art.Iterator(false)
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.Key()))
+		if len(keys) == 100 {
+			art.Delete([]byte("key-0500"))
+			art.Put([]byte("key-0501"), &data.LogRecordPos{Fid: 1, Offset: 501})
+		}
+	}
+	assert.Equal(t, 500, len(keys))
+	assert.Contains(t, keys, "key-0500")
+	assert.NotContains(t, keys, "key-0501")
+	for i := 1; i < len(keys); i++ {
+		assert.True(t, keys[i-1] < keys[i])
+	}
+
+	iter.Seek([]byte("key-0777"))
+	assert.Equal(t, "key-0778", string(iter.Key()))
+
+	reverseIter := art.Iterator(true)
+	reverseIter.Seek([]byte("key-0777"))
+	assert.Equal(t, "key-0776", string(reverseIter.Key()))
+	reverseIter.Next()
+	assert.Equal(t, "key-0774", string(reverseIter.Key()))
+}
@@ -0,0 +1,67 @@
+package index
+
+import (
+	"bitcask-go/data"
+	"bitcask-go/utils"
+	"math/rand"
+	"testing"
+)
+
+// 比较不同的内存索引的读写性能
+var benchIndexers = []struct {
+	name string
+	new  func() Indexer
+}{
+	{"btree", func() Indexer { return NewBTree() }},
+	{"art", func() Indexer { return NewART() }},
+	{"hash", func() Indexer { return NewHashIndex(nil) }},
+	{"skiplist", func() Indexer { return NewSkipList(nil) }},
+}
+
+func BenchmarkIndexer_Put(b *testing.B) {
+	for _, bi := range benchIndexers {
+		b.Run(bi.name, func(b *testing.B) {
+			idx := bi.new()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				idx.Put(utils.GetTestKey(i), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+			}
+		})
+	}
+}
+
+func BenchmarkIndexer_Get(b *testing.B) {
+	for _, bi := range benchIndexers {
+		b.Run(bi.name, func(b *testing.B) {
+			idx := bi.new()
+			for i := 0; i < 100000; i++ {
+				idx.Put(utils.GetTestKey(i), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				idx.Get(utils.GetTestKey(rand.Intn(100000)))
+			}
+		})
+	}
+}
+
+func BenchmarkIndexer_ParallelGet(b *testing.B) {
+	for _, bi := range benchIndexers {
+		b.Run(bi.name, func(b *testing.B) {
+			idx := bi.new()
+			for i := 0; i < 100000; i++ {
+				idx.Put(utils.GetTestKey(i), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				rnd := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					idx.Get(utils.GetTestKey(rnd.Intn(100000)))
+				}
+			})
+		})
+	}
+}
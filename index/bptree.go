@@ -2,56 +2,116 @@ package index
 
 import (
 	"bitcask-go/data"
+	"encoding/binary"
 	"go.etcd.io/bbolt"
 	"path/filepath"
+	"sync"
+	"time"
 )
 
-const bptreeIndexFileName = "bptree-index"
+const (
+	// BPlusTreeFileName B+ 树索引文件的名称
+	BPlusTreeFileName = "bptree-index"
 
-var indexBucketName = []byte("bitcask-index")
+	// 异步模式下定期提交缓存的索引更新的间隔
+	bptreeFlushInterval = 100 * time.Millisecond
+)
+
+var (
+	indexBucketName = []byte("bitcask-index")
+	metaBucketName  = []byte("bitcask-meta")
+	seqNoMetaKey    = []byte("seq-no")
+	appliedMetaKey  = []byte("applied-pos")
+	mergeMetaKey    = []byte("merge-fid")
+
+	// 持久化索引文件，测试中替换来模拟崩溃时丢失没有持久化的数据
+	syncBPlusTree = (*bbolt.DB).Sync
+)
+
+// BPlusTreeMeta 和索引在同一个事务中持久化的元数据
+type BPlusTreeMeta struct {
+	SeqNo    uint64             // 事务序列号
+	Applied  *data.LogRecordPos // 最后一条已经应用到索引中的记录的位置，打开时只需要重放之后的记录
+	MergeFid uint32             // 最近一次应用到索引中的 merge 的 nonMergeFileId，为 0 表示没有
+}
 
 // BPlusTree B+ 树索引
 // 主要封装了 go.etcd.io/bbolt 库
+// 每次更新索引时在同一个事务中记录最后一条已经应用的记录的位置，以及当前的事务序列号
+// 异步模式下索引更新先缓存在内存中，由后台任务批量提交，崩溃时丢失的更新在打开时从数据文件中重放
 type BPlusTree struct {
 	tree *bbolt.DB
+
+	mu       sync.Mutex
+	seqNo    uint64                  // 最新的事务序列号，随下一次提交一起持久化
+	pending  map[string]*bptreeWrite // 异步模式下还没有提交的索引更新
+	flushing map[string]*bptreeWrite // 正在提交的索引更新
+	applied  *data.LogRecordPos      // pending 中最后一条写入的位置
+
+	batchSize int           // 异步模式下缓存多少条更新之后提交，为 0 表示同步模式
+	flushMu   sync.Mutex    // 保证提交串行执行
+	flushCh   chan struct{} // 通知后台任务提交
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+}
+
+// 缓存的一条索引更新，pos 为空表示删除
+type bptreeWrite struct {
+	pos *data.LogRecordPos
 }
 
 // NewBPlusTree 初始化 B+ 树索引
 func NewBPlusTree(dirPath string, syncWrites bool) *BPlusTree {
+	return NewBPlusTreeAsync(dirPath, syncWrites, 0)
+}
+
+// NewBPlusTreeAsync 初始化异步更新的 B+ 树索引，缓存 batchSize 条更新或者每隔一段时间批量提交一次
+// batchSize 为 0 时每次更新都直接提交
+func NewBPlusTreeAsync(dirPath string, syncWrites bool, batchSize int) *BPlusTree {
 	opts := bbolt.DefaultOptions
 	opts.NoSync = !syncWrites
-	bptree, err := bbolt.Open(filepath.Join(dirPath, bptreeIndexFileName), 0644, opts)
+	bptree, err := bbolt.Open(filepath.Join(dirPath, BPlusTreeFileName), 0644, opts)
 	if err != nil {
 		panic("failed to open bptree")
 	}
 
 	// 创建对应的 bucket
 	if err := bptree.Update(func(tx *bbolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(indexBucketName)
+		if _, err := tx.CreateBucketIfNotExists(indexBucketName); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(metaBucketName)
 		return err
 	}); err != nil {
 		panic("failed to create bucket in bptree")
 	}
 
-	return &BPlusTree{tree: bptree}
+	bpt := &BPlusTree{tree: bptree, batchSize: batchSize}
+	if batchSize > 0 {
+		bpt.pending = make(map[string]*bptreeWrite)
+		bpt.flushCh = make(chan struct{}, 1)
+		bpt.closeCh = make(chan struct{})
+		bpt.wg.Add(1)
+		go bpt.flushLoop()
+	}
+	return bpt
 }
 
 func (bpt *BPlusTree) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
-	var oldVal []byte
-	if err := bpt.tree.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(indexBucketName)
-		oldVal = bucket.Get(key)
-		return bucket.Put(key, data.EncodeLogRecordPos(pos))
-	}); err != nil {
-		panic("failed to put value in bptree")
-	}
-	if len(oldVal) == 0 {
-		return nil
-	}
-	return data.DecodeLogRecordPos(oldVal)
+	return bpt.PutBatch([][]byte{key}, []*data.LogRecordPos{pos})[0]
 }
 
 func (bpt *BPlusTree) Get(key []byte) *data.LogRecordPos {
+	if bpt.batchSize > 0 {
+		if write, ok := bpt.cached(key); ok {
+			return write.pos
+		}
+	}
+	return bpt.get(key)
+}
+
+// 从索引文件中读取
+func (bpt *BPlusTree) get(key []byte) *data.LogRecordPos {
 	var pos *data.LogRecordPos
 	if err := bpt.tree.View(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(indexBucketName)
@@ -66,24 +126,254 @@ func (bpt *BPlusTree) Get(key []byte) *data.LogRecordPos {
 	return pos
 }
 
+// 查找还没有提交的索引更新
+func (bpt *BPlusTree) cached(key []byte) (*bptreeWrite, bool) {
+	bpt.mu.Lock()
+	defer bpt.mu.Unlock()
+	if write, ok := bpt.pending[string(key)]; ok {
+		return write, true
+	}
+	write, ok := bpt.flushing[string(key)]
+	return write, ok
+}
+
 func (bpt *BPlusTree) Delete(key []byte) (*data.LogRecordPos, bool) {
-	var oldVal []byte
+	oldPos := bpt.DeleteBatch([][]byte{key})[0]
+	return oldPos, oldPos != nil
+}
+
+// PutBatch 在一个事务中写入多条索引，同时记录最后一条已经应用的记录的位置
+func (bpt *BPlusTree) PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	return bpt.ApplyBatch(keys, positions, nil)
+}
+
+// DeleteBatch 在一个事务中删除多条索引
+func (bpt *BPlusTree) DeleteBatch(keys [][]byte) []*data.LogRecordPos {
+	return bpt.ApplyBatch(nil, nil, keys)
+}
+
+// ApplyBatch 在一个事务中删除 deleteKeys 并写入 putKeys，同时记录最后一条已经应用的记录的位置和事务序列号
+// 返回每个 key 旧的位置信息，deleteKeys 的在前，putKeys 的在后
+func (bpt *BPlusTree) ApplyBatch(putKeys [][]byte, putPositions []*data.LogRecordPos, deleteKeys [][]byte) []*data.LogRecordPos {
+	if bpt.batchSize > 0 {
+		keys := append(append([][]byte{}, deleteKeys...), putKeys...)
+		positions := append(make([]*data.LogRecordPos, len(deleteKeys)), putPositions...)
+		return bpt.cache(keys, positions)
+	}
+	oldPos := make([]*data.LogRecordPos, len(deleteKeys)+len(putKeys))
 	if err := bpt.tree.Update(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(indexBucketName)
-		if oldVal = bucket.Get(key); len(oldVal) != 0 {
-			return bucket.Delete(key)
+		for i, key := range deleteKeys {
+			if oldVal := bucket.Get(key); len(oldVal) != 0 {
+				oldPos[i] = data.DecodeLogRecordPos(oldVal)
+				if err := bucket.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+		for i, key := range putKeys {
+			if oldVal := bucket.Get(key); len(oldVal) != 0 {
+				oldPos[len(deleteKeys)+i] = data.DecodeLogRecordPos(oldVal)
+			}
+			if err := bucket.Put(key, data.EncodeLogRecordPos(putPositions[i])); err != nil {
+				return err
+			}
+		}
+		return bpt.putMeta(tx, lastPos(putPositions))
+	}); err != nil {
+		panic("failed to update values in bptree")
+	}
+	return oldPos
+}
+
+// 异步模式下将更新缓存到内存中，positions 中为空的表示删除
+func (bpt *BPlusTree) cache(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	oldPos := make([]*data.LogRecordPos, len(keys))
+	for i, key := range keys {
+		if write, ok := bpt.cached(key); ok {
+			oldPos[i] = write.pos
+		} else {
+			oldPos[i] = bpt.get(key)
+		}
+	}
+
+	bpt.mu.Lock()
+	for i, key := range keys {
+		bpt.pending[string(key)] = &bptreeWrite{pos: positions[i]}
+	}
+	if pos := lastPos(positions); pos != nil {
+		bpt.applied = pos
+	}
+	pendingNum := len(bpt.pending)
+	bpt.mu.Unlock()
+
+	if pendingNum >= bpt.batchSize*4 {
+		// 后台任务来不及提交时由写入方直接提交，避免缓存无限增长
+		if err := bpt.Flush(); err != nil {
+			panic("failed to flush bptree")
+		}
+	} else if pendingNum >= bpt.batchSize {
+		select {
+		case bpt.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	return oldPos
+}
+
+// 后台任务，缓存的更新足够多或者到达时间间隔时提交
+func (bpt *BPlusTree) flushLoop() {
+	defer bpt.wg.Done()
+	ticker := time.NewTicker(bptreeFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-bpt.closeCh:
+			return
+		case <-bpt.flushCh:
+		case <-ticker.C:
+		}
+		if err := bpt.Flush(); err != nil {
+			panic("failed to flush bptree")
+		}
+	}
+}
+
+// Flush 将缓存的索引更新和事务序列号在一个事务中提交到索引文件
+func (bpt *BPlusTree) Flush() error {
+	bpt.flushMu.Lock()
+	defer bpt.flushMu.Unlock()
+
+	bpt.mu.Lock()
+	writes, applied := bpt.pending, bpt.applied
+	bpt.flushing = writes
+	if bpt.batchSize > 0 {
+		bpt.pending = make(map[string]*bptreeWrite)
+	}
+	bpt.applied = nil
+	bpt.mu.Unlock()
+
+	err := bpt.tree.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(indexBucketName)
+		for key, write := range writes {
+			var err error
+			if write.pos == nil {
+				err = bucket.Delete([]byte(key))
+			} else {
+				err = bucket.Put([]byte(key), data.EncodeLogRecordPos(write.pos))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return bpt.putMeta(tx, applied)
+	})
+
+	bpt.mu.Lock()
+	bpt.flushing = nil
+	bpt.mu.Unlock()
+	return err
+}
+
+// SetSeqNo 更新事务序列号，和下一次提交的索引更新一起持久化
+func (bpt *BPlusTree) SetSeqNo(seqNo uint64) {
+	bpt.mu.Lock()
+	defer bpt.mu.Unlock()
+	if seqNo > bpt.seqNo {
+		bpt.seqNo = seqNo
+	}
+}
+
+// Meta 读取索引文件中的元数据，ok 为 false 表示还没有应用过任何记录
+func (bpt *BPlusTree) Meta() (meta BPlusTreeMeta, ok bool) {
+	if err := bpt.tree.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(metaBucketName)
+		if value := bucket.Get(seqNoMetaKey); len(value) != 0 {
+			meta.SeqNo, _ = binary.Uvarint(value)
+		}
+		if value := bucket.Get(appliedMetaKey); len(value) != 0 {
+			meta.Applied = data.DecodeLogRecordPos(value)
+			ok = true
+		}
+		if value := bucket.Get(mergeMetaKey); len(value) != 0 {
+			mergeFid, _ := binary.Uvarint(value)
+			meta.MergeFid = uint32(mergeFid)
 		}
 		return nil
 	}); err != nil {
-		panic("failed to delete value in bptree")
+		panic("failed to get meta in bptree")
 	}
-	if len(oldVal) == 0 {
-		return nil, false
+	return meta, ok
+}
+
+// ApplyMerge 用 merge 生成的 hint 文件中的索引替换掉所有的索引
+// 替换之后记录的位置是 nonMergeFid 文件的开头，打开时需要重放 merge 之后写入的所有数据
+// 索引、位置和 nonMergeFid 在同一个事务中提交，之后 Meta 返回的 MergeFid 等于 nonMergeFid
+// 返回之前索引文件已经持久化，调用方可以删除 merge 之前的数据文件
+func (bpt *BPlusTree) ApplyMerge(nonMergeFid uint32, keys [][]byte, positions []*data.LogRecordPos) error {
+	if err := bpt.Flush(); err != nil {
+		return err
 	}
-	return data.DecodeLogRecordPos(oldVal), true
+	if err := bpt.tree.Update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket(indexBucketName); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket(indexBucketName)
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			if err := bucket.Put(key, data.EncodeLogRecordPos(positions[i])); err != nil {
+				return err
+			}
+		}
+
+		buf := make([]byte, binary.MaxVarintLen32)
+		n := binary.PutUvarint(buf, uint64(nonMergeFid))
+		if err := tx.Bucket(metaBucketName).Put(mergeMetaKey, buf[:n]); err != nil {
+			return err
+		}
+		return tx.Bucket(metaBucketName).Put(appliedMetaKey, data.EncodeLogRecordPos(&data.LogRecordPos{Fid: nonMergeFid}))
+	}); err != nil {
+		return err
+	}
+	// 没有开启 SyncWrites 时提交的事务不会持久化
+	return syncBPlusTree(bpt.tree)
+}
+
+// 在事务中记录最后一条已经应用的记录的位置和当前的事务序列号
+func (bpt *BPlusTree) putMeta(tx *bbolt.Tx, applied *data.LogRecordPos) error {
+	bpt.mu.Lock()
+	seqNo := bpt.seqNo
+	bpt.mu.Unlock()
+
+	bucket := tx.Bucket(metaBucketName)
+	if seqNo > 0 {
+		buf := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(buf, seqNo)
+		if err := bucket.Put(seqNoMetaKey, buf[:n]); err != nil {
+			return err
+		}
+	}
+	if applied != nil {
+		return bucket.Put(appliedMetaKey, data.EncodeLogRecordPos(applied))
+	}
+	return nil
+}
+
+// 批量写入时数据按照写入的顺序排列，最后一条的位置最大
+func lastPos(positions []*data.LogRecordPos) *data.LogRecordPos {
+	var last *data.LogRecordPos
+	for _, pos := range positions {
+		if pos != nil && (last == nil || pos.Fid > last.Fid || (pos.Fid == last.Fid && pos.Offset > last.Offset)) {
+			last = pos
+		}
+	}
+	return last
 }
 
 func (bpt *BPlusTree) Size() int {
+	bpt.flushIfAsync()
 	var size int
 	if err := bpt.tree.View(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(indexBucketName)
@@ -95,11 +385,28 @@ func (bpt *BPlusTree) Size() int {
 	return size
 }
 
+// Iterator 异步模式下先提交缓存的更新，迭代器只读取索引文件
 func (bpt *BPlusTree) Iterator(reverse bool) Iterator {
+	bpt.flushIfAsync()
 	return newBptreeIterator(bpt.tree, reverse)
 }
 
+func (bpt *BPlusTree) flushIfAsync() {
+	if bpt.batchSize > 0 {
+		if err := bpt.Flush(); err != nil {
+			panic("failed to flush bptree")
+		}
+	}
+}
+
 func (bpt *BPlusTree) Close() error {
+	if bpt.batchSize > 0 {
+		close(bpt.closeCh)
+		bpt.wg.Wait()
+		if err := bpt.Flush(); err != nil {
+			return err
+		}
+	}
 	return bpt.tree.Close()
 }
 
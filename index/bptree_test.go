@@ -2,7 +2,9 @@ package index
 
 import (
 	"bitcask-go/data"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"go.etcd.io/bbolt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -107,3 +109,191 @@ func TestBPlusTree_Iterator(t *testing.T) {
 		assert.NotNil(t, iter.Value())
 	}
 }
+
+func TestBPlusTree_Batch(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "bptree-batch")
+	_ = os.MkdirAll(path, os.ModePerm)
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	tree := NewBPlusTree(path, false)
+
+	_, ok := tree.Meta()
+	assert.False(t, ok)
+
+	tree.Put([]byte("aac"), &data.LogRecordPos{Fid: 1, Offset: 10, Size: 5})
+	meta, ok := tree.Meta()
+	assert.True(t, ok)
+	assert.Equal(t, &data.LogRecordPos{Fid: 1, Offset: 10, Size: 5}, meta.Applied)
+
+	oldPos := tree.DeleteBatch([][]byte{[]byte("aac"), []byte("not exist")})
+	assert.Equal(t, int64(10), oldPos[0].Offset)
+	assert.Nil(t, oldPos[1])
+
+	tree.SetSeqNo(3)
+	oldPos = tree.PutBatch([][]byte{[]byte("abc"), []byte("acc")}, []*data.LogRecordPos{
+		{Fid: 1, Offset: 20, Size: 5},
+		{Fid: 1, Offset: 15, Size: 5},
+	})
+	assert.Equal(t, []*data.LogRecordPos{nil, nil}, oldPos)
+	assert.Nil(t, tree.Get([]byte("aac")))
+	assert.NotNil(t, tree.Get([]byte("abc")))
+
+	// 重新打开之后元数据仍然存在
+	assert.Nil(t, tree.Close())
+	tree = NewBPlusTree(path, false)
+	defer tree.Close()
+	meta, ok = tree.Meta()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), meta.SeqNo)
+	assert.Equal(t, int64(20), meta.Applied.Offset)
+}
+
+func TestBPlusTree_ApplyBatch(t *testing.T) {
+	for _, batchSize := range []int{0, 100} {
+		path := filepath.Join(os.TempDir(), "bptree-apply-batch")
+		_ = os.MkdirAll(path, os.ModePerm)
+		tree := NewBPlusTreeAsync(path, false, batchSize)
+		tree.Put([]byte("aac"), &data.LogRecordPos{Fid: 1, Offset: 10, Size: 5})
+
+		// 删除和写入在同一个事务中提交，同时更新元数据
+		tree.SetSeqNo(7)
+		oldPos := tree.ApplyBatch([][]byte{[]byte("abc")}, []*data.LogRecordPos{{Fid: 1, Offset: 30, Size: 5}},
+			[][]byte{[]byte("aac"), []byte("not exist")})
+		assert.Equal(t, []*data.LogRecordPos{{Fid: 1, Offset: 10, Size: 5}, nil, nil}, oldPos)
+		assert.Nil(t, tree.Get([]byte("aac")))
+		assert.Equal(t, int64(30), tree.Get([]byte("abc")).Offset)
+
+		// 只有删除的批次也会持久化事务序列号
+		tree.SetSeqNo(8)
+		oldPos = tree.ApplyBatch(nil, nil, [][]byte{[]byte("abc")})
+		assert.Equal(t, int64(30), oldPos[0].Offset)
+
+		assert.Nil(t, tree.Close())
+		tree = NewBPlusTree(path, false)
+		meta, ok := tree.Meta()
+		assert.True(t, ok)
+		assert.Equal(t, uint64(8), meta.SeqNo)
+		assert.Equal(t, int64(30), meta.Applied.Offset)
+		assert.Equal(t, 0, tree.Size())
+		assert.Nil(t, tree.Close())
+		_ = os.RemoveAll(path)
+	}
+}
+
+func TestBPlusTree_Async(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "bptree-async")
+	_ = os.MkdirAll(path, os.ModePerm)
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	tree := NewBPlusTreeAsync(path, false, 100)
+
+	for i := 0; i < 1000; i++ {
+		tree.Put([]byte(fmt.Sprintf("key-%04d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+	oldPos, ok := tree.Delete([]byte("key-0010"))
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), oldPos.Offset)
+	assert.Nil(t, tree.Get([]byte("key-0010")))
+	assert.Equal(t, int64(11), tree.Get([]byte("key-0011")).Offset)
+
+	// 遍历之前提交缓存的更新
+	var count int
+	iter := tree.Iterator(false)
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		count++
+	}
+	iter.Close()
+	assert.Equal(t, 999, count)
+	assert.Equal(t, 999, tree.Size())
+
+	// 崩溃时丢失还没有提交的更新，索引文件中记录的位置是最后一次提交的位置
+	close(tree.closeCh)
+	tree.wg.Wait()
+	tree.Put([]byte("key-1000"), &data.LogRecordPos{Fid: 2, Offset: 0})
+	assert.Nil(t, tree.tree.Close())
+	tree = NewBPlusTreeAsync(path, false, 100)
+	assert.Nil(t, tree.Get([]byte("key-1000")))
+	meta, ok := tree.Meta()
+	assert.True(t, ok)
+	assert.Equal(t, &data.LogRecordPos{Fid: 1, Offset: 999}, meta.Applied)
+
+	// 正常关闭时提交所有的更新
+	tree.Put([]byte("key-1000"), &data.LogRecordPos{Fid: 2, Offset: 0})
+	assert.Nil(t, tree.Close())
+	tree = NewBPlusTree(path, false)
+	defer tree.Close()
+	assert.NotNil(t, tree.Get([]byte("key-1000")))
+	meta, _ = tree.Meta()
+	assert.Equal(t, uint32(2), meta.Applied.Fid)
+}
+
+func TestBPlusTree_ApplyMerge(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "bptree-merge")
+	_ = os.MkdirAll(path, os.ModePerm)
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	tree := NewBPlusTree(path, false)
+	defer tree.Close()
+
+	tree.Put([]byte("aac"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	tree.Put([]byte("abc"), &data.LogRecordPos{Fid: 2, Offset: 24})
+	tree.SetSeqNo(5)
+
+	// merge 之后只保留 hint 文件中的索引
+	err := tree.ApplyMerge(3, [][]byte{[]byte("abc")}, []*data.LogRecordPos{{Fid: 0, Offset: 0}})
+	assert.Nil(t, err)
+	assert.Nil(t, tree.Get([]byte("aac")))
+	assert.Equal(t, &data.LogRecordPos{Fid: 0, Offset: 0}, tree.Get([]byte("abc")))
+	assert.Equal(t, 1, tree.Size())
+
+	meta, ok := tree.Meta()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(5), meta.SeqNo)
+	assert.Equal(t, uint32(3), meta.MergeFid)
+	assert.Equal(t, &data.LogRecordPos{Fid: 3}, meta.Applied)
+}
+
+func TestBPlusTree_ApplyMergeCrash(t *testing.T) {
+	path := filepath.Join(os.TempDir(), "bptree-merge-crash")
+	_ = os.MkdirAll(path, os.ModePerm)
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+	// 每次持久化时保存索引文件的内容，崩溃时丢弃之后没有持久化的写入
+	fileName := filepath.Join(path, BPlusTreeFileName)
+	var synced []byte
+	syncBPlusTree = func(db *bbolt.DB) error {
+		if err := db.Sync(); err != nil {
+			return err
+		}
+		var err error
+		synced, err = os.ReadFile(fileName)
+		return err
+	}
+	defer func() {
+		syncBPlusTree = (*bbolt.DB).Sync
+	}()
+
+	tree := NewBPlusTree(path, false)
+	tree.Put([]byte("aac"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	tree.Put([]byte("abc"), &data.LogRecordPos{Fid: 2, Offset: 24})
+	err := tree.ApplyMerge(3, [][]byte{[]byte("abc")}, []*data.LogRecordPos{{Fid: 0, Offset: 0}})
+	assert.Nil(t, err)
+	tree.Put([]byte("acc"), &data.LogRecordPos{Fid: 3, Offset: 0})
+	assert.Nil(t, tree.Close())
+	assert.Nil(t, os.WriteFile(fileName, synced, 0644))
+
+	// merge 的结果已经持久化，之后的写入丢失
+	tree = NewBPlusTree(path, false)
+	defer tree.Close()
+	meta, ok := tree.Meta()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(3), meta.MergeFid)
+	assert.Equal(t, &data.LogRecordPos{Fid: 3}, meta.Applied)
+	assert.Nil(t, tree.Get([]byte("aac")))
+	assert.Equal(t, &data.LogRecordPos{Fid: 0, Offset: 0}, tree.Get([]byte("abc")))
+	assert.Nil(t, tree.Get([]byte("acc")))
+}
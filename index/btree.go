@@ -2,59 +2,98 @@ package index
 
 import (
 	"bitcask-go/data"
-	"bytes"
 	"github.com/google/btree"
-	"sort"
 	"sync"
 )
 
 // BTree 索引，主要封装了 google 的 btree ku
 // https://github.com/google/btree
 type BTree struct {
-	tree *btree.BTree
-	lock *sync.RWMutex
+	tree       *btree.BTreeG[*Item]
+	lock       *sync.RWMutex
+	comparator Comparator
 }
 
 // NewBTree 新建 BTree 索引结构
 func NewBTree() *BTree {
+	return NewBTreeWithComparator(BytewiseComparator)
+}
+
+// NewBTreeWithComparator 新建使用指定比较器排序的 BTree 索引结构，comparator 为空时按照字节序排序
+func NewBTreeWithComparator(comparator Comparator) *BTree {
+	if comparator == nil {
+		comparator = BytewiseComparator
+	}
+	less := func(a, b *Item) bool {
+		return comparator.Compare(a.key, b.key) < 0
+	}
 	return &BTree{
-		tree: btree.New(32),
-		lock: new(sync.RWMutex),
+		tree:       btree.NewG(32, less),
+		lock:       new(sync.RWMutex),
+		comparator: comparator,
 	}
 }
 
 func (bt *BTree) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
 	it := &Item{key: key, pos: pos}
 	bt.lock.Lock()
-	oldItem := bt.tree.ReplaceOrInsert(it)
+	oldItem, _ := bt.tree.ReplaceOrInsert(it)
 	bt.lock.Unlock()
 	if oldItem == nil {
 		return nil
 	}
-	return oldItem.(*Item).pos
+	return oldItem.pos
 }
 
 func (bt *BTree) Get(key []byte) *data.LogRecordPos {
 	it := &Item{key: key}
-	btreeItem := bt.tree.Get(it)
+	bt.lock.RLock()
+	btreeItem, _ := bt.tree.Get(it)
+	bt.lock.RUnlock()
 	if btreeItem == nil {
 		return nil
 	}
-	return btreeItem.(*Item).pos
+	return btreeItem.pos
 }
 
 func (bt *BTree) Delete(key []byte) (*data.LogRecordPos, bool) {
 	it := &Item{key: key}
 	bt.lock.Lock()
-	oldItem := bt.tree.Delete(it)
+	oldItem, _ := bt.tree.Delete(it)
 	bt.lock.Unlock()
 	if oldItem == nil {
 		return nil, false
 	}
-	return oldItem.(*Item).pos, true
+	return oldItem.pos, true
+}
+
+func (bt *BTree) PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	oldPos := make([]*data.LogRecordPos, len(keys))
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+	for i, key := range keys {
+		if oldItem, _ := bt.tree.ReplaceOrInsert(&Item{key: key, pos: positions[i]}); oldItem != nil {
+			oldPos[i] = oldItem.pos
+		}
+	}
+	return oldPos
+}
+
+func (bt *BTree) DeleteBatch(keys [][]byte) []*data.LogRecordPos {
+	oldPos := make([]*data.LogRecordPos, len(keys))
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+	for i, key := range keys {
+		if oldItem, _ := bt.tree.Delete(&Item{key: key}); oldItem != nil {
+			oldPos[i] = oldItem.pos
+		}
+	}
+	return oldPos
 }
 
 func (bt *BTree) Size() int {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
 	return bt.tree.Len()
 }
 
@@ -62,63 +101,71 @@ func (bt *BTree) Iterator(reverse bool) Iterator {
 	if bt.tree == nil {
 		return nil
 	}
-	bt.lock.RLock()
-	defer bt.lock.RUnlock()
-	return newBTreeIterator(bt.tree, reverse)
+	return newBTreeIterator(bt, reverse)
 }
 
 func (bt *BTree) Close() error {
 	return nil
 }
 
-// BTree 索引迭代器
+// BTree 索引迭代器，每次加锁从树中读取一批数据，不会复制整个索引
+// 读完一批之后从上一批最后一个 key 的位置重新查找，所以树在两批之间被修改也可以继续遍历
 type btreeIterator struct {
-	currIndex int     // 当前遍历的下标位置
+	bt        *BTree
 	reverse   bool    // 是否是反向遍历
-	values    []*Item // key+位置索引信息
+	values    []*Item // 当前批次的 key+位置索引信息
+	currIndex int     // 当前遍历的下标位置
+	exhausted bool    // 当前批次之后是否已经没有数据
 }
 
-func newBTreeIterator(tree *btree.BTree, reverse bool) *btreeIterator {
-	var idx int
-	values := make([]*Item, tree.Len())
-
-	// 将所有的数据存放到数组中
-	saveValues := func(it btree.Item) bool {
-		values[idx] = it.(*Item)
-		idx++
-		return true
-	}
-	if reverse {
-		tree.Descend(saveValues)
-	} else {
-		tree.Ascend(saveValues)
-	}
-
-	return &btreeIterator{
-		currIndex: 0,
-		reverse:   reverse,
-		values:    values,
-	}
+func newBTreeIterator(bt *BTree, reverse bool) *btreeIterator {
+	bti := &btreeIterator{bt: bt, reverse: reverse}
+	bti.Rewind()
+	return bti
 }
 
 func (bti *btreeIterator) Rewind() {
-	bti.currIndex = 0
+	bti.fill(nil, false, false)
 }
 
 func (bti *btreeIterator) Seek(key []byte) {
-	if bti.reverse {
-		bti.currIndex = sort.Search(len(bti.values), func(i int) bool {
-			return bytes.Compare(bti.values[i].key, key) <= 0
-		})
-	} else {
-		bti.currIndex = sort.Search(len(bti.values), func(i int) bool {
-			return bytes.Compare(bti.values[i].key, key) >= 0
-		})
-	}
+	bti.fill(key, true, true)
 }
 
 func (bti *btreeIterator) Next() {
 	bti.currIndex += 1
+	if bti.currIndex == len(bti.values) && !bti.exhausted {
+		bti.fill(bti.values[len(bti.values)-1].key, true, false)
+	}
+}
+
+// 读取下一批数据，hasPivot 为 false 时从头开始读取，否则从 pivot 开始读取，inclusive 表示是否包含 pivot
+func (bti *btreeIterator) fill(pivot []byte, hasPivot, inclusive bool) {
+	values := bti.values[:0]
+	saveValues := func(it *Item) bool {
+		if !inclusive && hasPivot && bti.bt.comparator.Compare(it.key, pivot) == 0 {
+			return true
+		}
+		values = append(values, it)
+		return len(values) < iteratorBatchSize
+	}
+
+	bti.bt.lock.RLock()
+	switch {
+	case !hasPivot && bti.reverse:
+		bti.bt.tree.Descend(saveValues)
+	case !hasPivot:
+		bti.bt.tree.Ascend(saveValues)
+	case bti.reverse:
+		bti.bt.tree.DescendLessOrEqual(&Item{key: pivot}, saveValues)
+	default:
+		bti.bt.tree.AscendGreaterOrEqual(&Item{key: pivot}, saveValues)
+	}
+	bti.bt.lock.RUnlock()
+
+	bti.values = values
+	bti.currIndex = 0
+	bti.exhausted = len(values) < iteratorBatchSize
 }
 
 func (bti *btreeIterator) Valid() bool {
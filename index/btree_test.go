@@ -2,6 +2,7 @@ package index
 
 import (
 	"bitcask-go/data"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -99,3 +100,71 @@ func TestBTree_Iterator(t *testing.T) {
 		assert.NotNil(t, iter6.Key())
 	}
 }
+
+// 按照字节序倒序排列的比较器
+type reverseComparator struct{}
+
+func (reverseComparator) Name() string { return "test.ReverseComparator" }
+
+func (reverseComparator) Compare(a, b []byte) int { return -BytewiseComparator.Compare(a, b) }
+
+func TestBTree_Comparator(t *testing.T) {
+	bt := NewBTreeWithComparator(reverseComparator{})
+	for _, key := range []string{"bbcd", "acee", "eede", "ccde"} {
+		bt.Put([]byte(key), &data.LogRecordPos{Fid: 1, Offset: 10})
+	}
+	assert.NotNil(t, bt.Get([]byte("acee")))
+
+	var keys []string
+	iter := bt.Iterator(false)
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	assert.Equal(t, []string{"eede", "ccde", "bbcd", "acee"}, keys)
+
+	// seek 按照比较器的顺序查找第一个大于等于的 key
+	iter.Seek([]byte("cc"))
+	assert.Equal(t, "bbcd", string(iter.Key()))
+
+	reverseIter := bt.Iterator(true)
+	reverseIter.Seek([]byte("cc"))
+	assert.Equal(t, "ccde", string(reverseIter.Key()))
+}
+
+func TestBTree_IteratorBatches(t *testing.T) {
+	bt := NewBTree()
+	for i := 0; i < 1000; i += 2 {
+		bt.Put([]byte(fmt.Sprintf("key-%04d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	// 遍历的过程中修改索引，key 保持有序并且不会重复
+	var keys []string
+	iter := bt.Iterator(false)
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.Key()))
+		if len(keys) == 100 {
+			bt.Delete([]byte("key-0500"))
+			bt.Put([]byte("key-0501"), &data.LogRecordPos{Fid: 1, Offset: 501})
+			bt.Put([]byte("key-0001"), &data.LogRecordPos{Fid: 1, Offset: 1})
+		}
+	}
+	assert.Equal(t, 500, len(keys))
+	assert.Contains(t, keys, "key-0501")
+	assert.NotContains(t, keys, "key-0500")
+	assert.NotContains(t, keys, "key-0001")
+	for i := 1; i < len(keys); i++ {
+		assert.True(t, keys[i-1] < keys[i])
+	}
+
+	iter.Seek([]byte("key-0777"))
+	assert.Equal(t, "key-0778", string(iter.Key()))
+
+	reverseIter := bt.Iterator(true)
+	reverseIter.Seek([]byte("key-0777"))
+	assert.Equal(t, "key-0776", string(reverseIter.Key()))
+	var count int
+	for ; reverseIter.Valid(); reverseIter.Next() {
+		count++
+	}
+	assert.Equal(t, 390, count)
+}
@@ -0,0 +1,30 @@
+package index
+
+import "bytes"
+
+// Comparator 自定义 key 的排序规则
+type Comparator interface {
+	// Name 比较器的名称，会被持久化到数据目录中，重新打开时必须使用相同名称的比较器
+	Name() string
+
+	// Compare 比较两个 key，a < b 时返回负数，a == b 时返回 0，a > b 时返回正数
+	Compare(a, b []byte) int
+}
+
+// BytewiseComparator 默认的比较器，按照字节序比较
+var BytewiseComparator Comparator = bytewiseComparator{}
+
+type bytewiseComparator struct{}
+
+func (bytewiseComparator) Name() string {
+	return "bitcask.BytewiseComparator"
+}
+
+func (bytewiseComparator) Compare(a, b []byte) int {
+	return bytes.Compare(a, b)
+}
+
+// IsBytewise 判断比较器是否按照字节序比较，为空时使用默认的比较器
+func IsBytewise(comparator Comparator) bool {
+	return comparator == nil || comparator.Name() == BytewiseComparator.Name()
+}
@@ -0,0 +1,154 @@
+package index
+
+import (
+	"bitcask-go/data"
+	"hash/maphash"
+	"sort"
+	"sync"
+)
+
+// hash 索引的分片数量，必须是 2 的幂
+const hashShardCount = 256
+
+// HashIndex 分片的哈希表索引，适用于只有点查、不需要遍历的场景
+// 每个分片有单独的锁，查找的时间复杂度为 O(1)
+// 遍历时需要取出所有的 key 并排序，速度较慢
+type HashIndex struct {
+	seed       maphash.Seed
+	shards     [hashShardCount]*hashShard
+	comparator Comparator
+}
+
+type hashShard struct {
+	lock  sync.RWMutex
+	items map[string]hashPos
+}
+
+// hashPos 紧凑存储的位置信息，直接保存在 map 中，不需要为每个 key 单独分配 LogRecordPos
+type hashPos struct {
+	offset int64
+	fid    uint32
+	size   uint32
+}
+
+func newHashPos(pos *data.LogRecordPos) hashPos {
+	return hashPos{offset: pos.Offset, fid: pos.Fid, size: pos.Size}
+}
+
+func (hp hashPos) logRecordPos() *data.LogRecordPos {
+	return &data.LogRecordPos{Fid: hp.fid, Offset: hp.offset, Size: hp.size}
+}
+
+// NewHashIndex 初始化哈希表索引，comparator 为空时遍历按照字节序排序
+func NewHashIndex(comparator Comparator) *HashIndex {
+	if comparator == nil {
+		comparator = BytewiseComparator
+	}
+	hi := &HashIndex{
+		seed:       maphash.MakeSeed(),
+		comparator: comparator,
+	}
+	for i := range hi.shards {
+		hi.shards[i] = &hashShard{items: make(map[string]hashPos)}
+	}
+	return hi
+}
+
+// 根据 key 的哈希值找到所在的分片
+func (hi *HashIndex) shard(key []byte) *hashShard {
+	return hi.shards[maphash.Bytes(hi.seed, key)&(hashShardCount-1)]
+}
+
+func (hi *HashIndex) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
+	shard := hi.shard(key)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	oldPos, ok := shard.items[string(key)]
+	shard.items[string(key)] = newHashPos(pos)
+	if !ok {
+		return nil
+	}
+	return oldPos.logRecordPos()
+}
+
+func (hi *HashIndex) Get(key []byte) *data.LogRecordPos {
+	shard := hi.shard(key)
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+	pos, ok := shard.items[string(key)]
+	if !ok {
+		return nil
+	}
+	return pos.logRecordPos()
+}
+
+func (hi *HashIndex) Delete(key []byte) (*data.LogRecordPos, bool) {
+	shard := hi.shard(key)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	oldPos, ok := shard.items[string(key)]
+	if !ok {
+		return nil, false
+	}
+	delete(shard.items, string(key))
+	return oldPos.logRecordPos(), true
+}
+
+// PutBatch 每个 key 分别对所在的分片加锁
+func (hi *HashIndex) PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	oldPos := make([]*data.LogRecordPos, len(keys))
+	for i, key := range keys {
+		oldPos[i] = hi.Put(key, positions[i])
+	}
+	return oldPos
+}
+
+func (hi *HashIndex) DeleteBatch(keys [][]byte) []*data.LogRecordPos {
+	oldPos := make([]*data.LogRecordPos, len(keys))
+	for i, key := range keys {
+		oldPos[i], _ = hi.Delete(key)
+	}
+	return oldPos
+}
+
+func (hi *HashIndex) Size() int {
+	var size int
+	for _, shard := range hi.shards {
+		shard.lock.RLock()
+		size += len(shard.items)
+		shard.lock.RUnlock()
+	}
+	return size
+}
+
+// Iterator 取出所有分片中的数据并按照比较器排序
+// 各个分片依次加锁，遍历的结果不是某一时刻的快照
+func (hi *HashIndex) Iterator(reverse bool) Iterator {
+	var values []*Item
+	for _, shard := range hi.shards {
+		shard.lock.RLock()
+		for key, pos := range shard.items {
+			values = append(values, &Item{key: []byte(key), pos: pos.logRecordPos()})
+		}
+		shard.lock.RUnlock()
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		cmp := hi.comparator.Compare(values[i].key, values[j].key)
+		if reverse {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	return &sliceIterator{
+		currIndex:  0,
+		reverse:    reverse,
+		values:     values,
+		comparator: hi.comparator,
+	}
+}
+
+func (hi *HashIndex) Close() error {
+	return nil
+}
@@ -0,0 +1,93 @@
+package index
+
+import (
+	"bitcask-go/data"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestHashIndex_Put(t *testing.T) {
+	hi := NewHashIndex(nil)
+
+	res1 := hi.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	assert.Nil(t, res1)
+
+	res2 := hi.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2, Size: 5})
+	assert.Nil(t, res2)
+
+	res3 := hi.Put([]byte("a"), &data.LogRecordPos{Fid: 11, Offset: 12})
+	assert.Equal(t, &data.LogRecordPos{Fid: 1, Offset: 2, Size: 5}, res3)
+}
+
+func TestHashIndex_Get(t *testing.T) {
+	hi := NewHashIndex(nil)
+	hi.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2, Size: 5})
+
+	pos := hi.Get([]byte("a"))
+	assert.Equal(t, &data.LogRecordPos{Fid: 1, Offset: 2, Size: 5}, pos)
+	assert.Nil(t, hi.Get([]byte("not exist")))
+}
+
+func TestHashIndex_Delete(t *testing.T) {
+	hi := NewHashIndex(nil)
+	res1, ok1 := hi.Delete([]byte("not exist"))
+	assert.Nil(t, res1)
+	assert.False(t, ok1)
+
+	hi.Put([]byte("aaa"), &data.LogRecordPos{Fid: 22, Offset: 33})
+	res2, ok2 := hi.Delete([]byte("aaa"))
+	assert.True(t, ok2)
+	assert.Equal(t, uint32(22), res2.Fid)
+	assert.Equal(t, int64(33), res2.Offset)
+	assert.Nil(t, hi.Get([]byte("aaa")))
+	assert.Equal(t, 0, hi.Size())
+}
+
+func TestHashIndex_Iterator(t *testing.T) {
+	hi := NewHashIndex(nil)
+	iter1 := hi.Iterator(false)
+	assert.False(t, iter1.Valid())
+
+	for _, key := range []string{"ccde", "acee", "eede", "bbcd"} {
+		hi.Put([]byte(key), &data.LogRecordPos{Fid: 1, Offset: 10})
+	}
+	var keys []string
+	iter2 := hi.Iterator(false)
+	for iter2.Rewind(); iter2.Valid(); iter2.Next() {
+		keys = append(keys, string(iter2.Key()))
+	}
+	assert.Equal(t, []string{"acee", "bbcd", "ccde", "eede"}, keys)
+
+	iter3 := hi.Iterator(true)
+	iter3.Seek([]byte("cc"))
+	assert.Equal(t, "bbcd", string(iter3.Key()))
+
+	// 使用自定义的比较器排序
+	iter4 := NewHashIndex(reverseComparator{}).Iterator(false)
+	assert.False(t, iter4.Valid())
+	hi2 := NewHashIndex(reverseComparator{})
+	hi2.Put([]byte("a"), &data.LogRecordPos{})
+	hi2.Put([]byte("b"), &data.LogRecordPos{})
+	iter5 := hi2.Iterator(false)
+	assert.Equal(t, "b", string(iter5.Key()))
+}
+
+func TestHashIndex_Concurrent(t *testing.T) {
+	hi := NewHashIndex(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := []byte(fmt.Sprintf("key-%d-%d", n, j))
+				hi.Put(key, &data.LogRecordPos{Fid: uint32(n), Offset: int64(j)})
+				assert.Equal(t, int64(j), hi.Get(key).Offset)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 8000, hi.Size())
+}
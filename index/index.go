@@ -17,6 +17,12 @@ type Indexer interface {
 	// Delete 根据 key 删除对应的索引位置信息
 	Delete(key []byte) (*data.LogRecordPos, bool)
 
+	// PutBatch 批量存储 key 对应的数据位置信息，返回每个 key 旧的位置信息
+	PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos
+
+	// DeleteBatch 批量删除 key 对应的索引位置信息，返回每个 key 旧的位置信息，不存在时为空
+	DeleteBatch(keys [][]byte) []*data.LogRecordPos
+
 	// Size 索引中的数据量
 	Size() int
 
@@ -38,17 +44,28 @@ const (
 
 	// BPTree B+ 树索引
 	BPTree
+
+	// Hash 分片哈希表索引
+	Hash
+
+	// SkipList 无锁的并发跳表索引
+	SkipList
 )
 
-// NewIndexer 根据类型初始化索引
-func NewIndexer(typ IndexType, dirPath string, sync bool) Indexer {
+// NewIndexer 根据类型初始化索引，comparator 为空时按照字节序排序
+// ART 和 B+ 树索引不支持自定义的比较器，asyncBatchSize 大于 0 时 B+ 树索引异步批量提交更新
+func NewIndexer(typ IndexType, dirPath string, sync bool, comparator Comparator, asyncBatchSize int) Indexer {
 	switch typ {
 	case Btree:
-		return NewBTree()
+		return NewBTreeWithComparator(comparator)
 	case ART:
 		return NewART()
 	case BPTree:
-		return NewBPlusTree(dirPath, sync)
+		return NewBPlusTreeAsync(dirPath, sync, asyncBatchSize)
+	case Hash:
+		return NewHashIndex(comparator)
+	case SkipList:
+		return NewSkipList(comparator)
 	default:
 		panic("unsupported index type")
 	}
@@ -0,0 +1,75 @@
+package index
+
+import (
+	"bitcask-go/data"
+	"sort"
+)
+
+// 迭代器每次从索引中读取的数据量
+// 同一批数据是加锁时索引的一致视图，批次之间并发的修改可能可见也可能不可见，但是 key 保持有序并且不会重复
+const iteratorBatchSize = 64
+
+// 遍历已经排好序的数据的迭代器，用于不能按顺序增量遍历的索引
+type sliceIterator struct {
+	currIndex  int        // 当前遍历的下标位置
+	reverse    bool       // 是否是反向遍历
+	values     []*Item    // key+位置索引信息
+	comparator Comparator // key 的排序规则
+}
+
+// NewSliceIterator 遍历已经排好序的快照，keys 按照 comparator 从小到大排列，positions 是对应的位置信息
+func NewSliceIterator(keys [][]byte, positions []*data.LogRecordPos, reverse bool, comparator Comparator) Iterator {
+	if comparator == nil {
+		comparator = BytewiseComparator
+	}
+	values := make([]*Item, len(keys))
+	for i := range keys {
+		idx := i
+		if reverse {
+			idx = len(keys) - 1 - i
+		}
+		values[i] = &Item{key: keys[idx], pos: positions[idx]}
+	}
+	return &sliceIterator{
+		currIndex:  0,
+		reverse:    reverse,
+		values:     values,
+		comparator: comparator,
+	}
+}
+
+func (si *sliceIterator) Rewind() {
+	si.currIndex = 0
+}
+
+func (si *sliceIterator) Seek(key []byte) {
+	if si.reverse {
+		si.currIndex = sort.Search(len(si.values), func(i int) bool {
+			return si.comparator.Compare(si.values[i].key, key) <= 0
+		})
+	} else {
+		si.currIndex = sort.Search(len(si.values), func(i int) bool {
+			return si.comparator.Compare(si.values[i].key, key) >= 0
+		})
+	}
+}
+
+func (si *sliceIterator) Next() {
+	si.currIndex += 1
+}
+
+func (si *sliceIterator) Valid() bool {
+	return si.currIndex < len(si.values)
+}
+
+func (si *sliceIterator) Key() []byte {
+	return si.values[si.currIndex].key
+}
+
+func (si *sliceIterator) Value() *data.LogRecordPos {
+	return si.values[si.currIndex].pos
+}
+
+func (si *sliceIterator) Close() {
+	si.values = nil
+}
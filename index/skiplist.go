@@ -0,0 +1,346 @@
+package index
+
+import (
+	"bitcask-go/data"
+	"hash/maphash"
+	"math/bits"
+	"sync/atomic"
+)
+
+// 跳表的最大层数，每一层的节点数是下一层的 1/4，可以容纳 4^20 个 key
+const skipListMaxLevel = 20
+
+// ConcurrentSkipList 无锁的并发跳表索引
+// 读操作不会阻塞，写操作通过 CAS 更新节点的指针和位置信息
+// 删除时先将节点的位置信息置为空（逻辑删除），再标记节点每一层的指针，最后从链表中摘除（物理删除）
+type ConcurrentSkipList struct {
+	head       *skipListNode
+	size       atomic.Int64
+	seed       maphash.Seed
+	comparator Comparator
+}
+
+type skipListNode struct {
+	key   []byte
+	value atomic.Pointer[data.LogRecordPos] // 为空表示节点已经被删除
+	next  []atomic.Pointer[skipListRef]
+}
+
+// skipListRef 指向下一个节点的指针，marked 表示当前节点在这一层已经被删除
+// 指针和标记一起通过 CAS 更新，创建之后不会修改
+type skipListRef struct {
+	node   *skipListNode
+	marked bool
+}
+
+func newSkipListNode(key []byte, level int) *skipListNode {
+	node := &skipListNode{key: key, next: make([]atomic.Pointer[skipListRef], level)}
+	for i := range node.next {
+		node.next[i].Store(&skipListRef{})
+	}
+	return node
+}
+
+// NewSkipList 初始化跳表索引，comparator 为空时按照字节序排序
+func NewSkipList(comparator Comparator) *ConcurrentSkipList {
+	if comparator == nil {
+		comparator = BytewiseComparator
+	}
+	return &ConcurrentSkipList{
+		head:       newSkipListNode(nil, skipListMaxLevel),
+		seed:       maphash.MakeSeed(),
+		comparator: comparator,
+	}
+}
+
+// 根据 key 的哈希值计算节点的层数，不需要加锁的随机数
+func (sl *ConcurrentSkipList) randomLevel(key []byte) int {
+	level := 1 + bits.TrailingZeros64(maphash.Bytes(sl.seed, key)|1<<63)/2
+	if level > skipListMaxLevel {
+		level = skipListMaxLevel
+	}
+	return level
+}
+
+// 查找每一层中 key 的前驱节点和后继节点，后继节点的 key 大于等于查找的 key
+// 查找的过程中会摘除已经标记删除的节点
+func (sl *ConcurrentSkipList) find(key []byte, preds, succs *[skipListMaxLevel]*skipListNode) bool {
+retry:
+	pred := sl.head
+	for level := skipListMaxLevel - 1; level >= 0; level-- {
+		curr := pred.next[level].Load().node
+		for curr != nil {
+			ref := curr.next[level].Load()
+			for ref.marked {
+				// 摘除已经删除的节点，前驱节点发生了变化时重新查找
+				predRef := pred.next[level].Load()
+				if predRef.node != curr || predRef.marked {
+					goto retry
+				}
+				if !pred.next[level].CompareAndSwap(predRef, &skipListRef{node: ref.node}) {
+					goto retry
+				}
+				curr = ref.node
+				if curr == nil {
+					break
+				}
+				ref = curr.next[level].Load()
+			}
+			if curr == nil || sl.comparator.Compare(curr.key, key) >= 0 {
+				break
+			}
+			pred, curr = curr, ref.node
+		}
+		preds[level], succs[level] = pred, curr
+	}
+	return succs[0] != nil && sl.comparator.Compare(succs[0].key, key) == 0
+}
+
+// 标记节点每一层的指针，标记之后节点不会再链接新的后继节点
+func (sl *ConcurrentSkipList) mark(node *skipListNode) {
+	for level := len(node.next) - 1; level >= 0; level-- {
+		for {
+			ref := node.next[level].Load()
+			if ref.marked || node.next[level].CompareAndSwap(ref, &skipListRef{node: ref.node, marked: true}) {
+				break
+			}
+		}
+	}
+}
+
+func (sl *ConcurrentSkipList) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
+	var preds, succs [skipListMaxLevel]*skipListNode
+	for {
+		if sl.find(key, &preds, &succs) {
+			node := succs[0]
+			oldPos := node.value.Load()
+			if oldPos == nil {
+				// 节点正在被删除，帮助完成删除之后重新插入
+				sl.mark(node)
+				continue
+			}
+			if node.value.CompareAndSwap(oldPos, pos) {
+				return oldPos
+			}
+			continue
+		}
+
+		level := sl.randomLevel(key)
+		node := newSkipListNode(key, level)
+		node.value.Store(pos)
+		node.next[0].Store(&skipListRef{node: succs[0]})
+		predRef := preds[0].next[0].Load()
+		if predRef.node != succs[0] || predRef.marked ||
+			!preds[0].next[0].CompareAndSwap(predRef, &skipListRef{node: node}) {
+			continue
+		}
+		sl.size.Add(1)
+		sl.linkUpperLevels(node, level, &preds, &succs)
+		return nil
+	}
+}
+
+// 将新插入的节点链接到上面的各层，节点被并发删除时停止
+func (sl *ConcurrentSkipList) linkUpperLevels(node *skipListNode, level int, preds, succs *[skipListMaxLevel]*skipListNode) {
+	for l := 1; l < level; l++ {
+		for {
+			ref := node.next[l].Load()
+			if ref.marked {
+				return
+			}
+			if ref.node != succs[l] && !node.next[l].CompareAndSwap(ref, &skipListRef{node: succs[l]}) {
+				continue
+			}
+			predRef := preds[l].next[l].Load()
+			if predRef.node == succs[l] && !predRef.marked &&
+				preds[l].next[l].CompareAndSwap(predRef, &skipListRef{node: node}) {
+				break
+			}
+			if !sl.find(node.key, preds, succs) || succs[0] != node {
+				return
+			}
+		}
+	}
+}
+
+func (sl *ConcurrentSkipList) Get(key []byte) *data.LogRecordPos {
+	node := sl.seekNode(key)
+	if node == nil || sl.comparator.Compare(node.key, key) != 0 {
+		return nil
+	}
+	return node.value.Load()
+}
+
+func (sl *ConcurrentSkipList) Delete(key []byte) (*data.LogRecordPos, bool) {
+	var preds, succs [skipListMaxLevel]*skipListNode
+	if !sl.find(key, &preds, &succs) {
+		return nil, false
+	}
+	node := succs[0]
+	for {
+		oldPos := node.value.Load()
+		if oldPos == nil {
+			return nil, false
+		}
+		if node.value.CompareAndSwap(oldPos, nil) {
+			sl.size.Add(-1)
+			sl.mark(node)
+			sl.find(key, &preds, &succs)
+			return oldPos, true
+		}
+	}
+}
+
+// PutBatch 每个 key 分别更新，并发读取时可能看到一部分更新
+func (sl *ConcurrentSkipList) PutBatch(keys [][]byte, positions []*data.LogRecordPos) []*data.LogRecordPos {
+	oldPos := make([]*data.LogRecordPos, len(keys))
+	for i, key := range keys {
+		oldPos[i] = sl.Put(key, positions[i])
+	}
+	return oldPos
+}
+
+func (sl *ConcurrentSkipList) DeleteBatch(keys [][]byte) []*data.LogRecordPos {
+	oldPos := make([]*data.LogRecordPos, len(keys))
+	for i, key := range keys {
+		oldPos[i], _ = sl.Delete(key)
+	}
+	return oldPos
+}
+
+func (sl *ConcurrentSkipList) Size() int {
+	return int(sl.size.Load())
+}
+
+func (sl *ConcurrentSkipList) Iterator(reverse bool) Iterator {
+	si := &skipListIterator{sl: sl, reverse: reverse}
+	si.Rewind()
+	return si
+}
+
+func (sl *ConcurrentSkipList) Close() error {
+	return nil
+}
+
+// 查找第一个 key 大于等于 key 的节点，只读取指针，不会修改跳表
+func (sl *ConcurrentSkipList) seekNode(key []byte) *skipListNode {
+	_, curr := sl.search(key, false)
+	return curr
+}
+
+// 查找最后一个 key 小于 key 的节点，没有时返回 head
+func (sl *ConcurrentSkipList) seekLessNode(key []byte) *skipListNode {
+	pred, _ := sl.search(key, false)
+	return pred
+}
+
+// 查找最后一个节点，跳表为空时返回 head
+func (sl *ConcurrentSkipList) lastNode() *skipListNode {
+	pred, _ := sl.search(nil, true)
+	return pred
+}
+
+// 只读的查找，返回最后一个 key 小于 key 的节点和它在第 0 层的后继节点，toEnd 为 true 时查找到最后一个节点
+// 已经标记删除的节点的指针可能已经过期，不能作为前驱节点继续向下查找
+func (sl *ConcurrentSkipList) search(key []byte, toEnd bool) (*skipListNode, *skipListNode) {
+	pred := sl.head
+	var curr *skipListNode
+	for level := skipListMaxLevel - 1; level >= 0; level-- {
+		curr = pred.next[level].Load().node
+		for curr != nil {
+			ref := curr.next[level].Load()
+			if ref.marked {
+				curr = ref.node
+				continue
+			}
+			if !toEnd && sl.comparator.Compare(curr.key, key) >= 0 {
+				break
+			}
+			pred, curr = curr, ref.node
+		}
+	}
+	return pred, curr
+}
+
+// 跳表索引迭代器，直接在跳表上遍历，不会复制所有的数据
+// 遍历时可能看到也可能看不到并发的写入，会跳过已经删除的节点
+type skipListIterator struct {
+	sl      *ConcurrentSkipList
+	reverse bool
+	node    *skipListNode      // 当前遍历到的节点，为空表示遍历结束
+	value   *data.LogRecordPos // 移动到当前节点时读取的位置信息
+}
+
+func (si *skipListIterator) Rewind() {
+	if si.reverse {
+		si.setReverse(si.sl.lastNode())
+	} else {
+		si.setForward(si.sl.head.next[0].Load().node)
+	}
+}
+
+func (si *skipListIterator) Seek(key []byte) {
+	if !si.reverse {
+		si.setForward(si.sl.seekNode(key))
+		return
+	}
+	// 反向遍历时找到最后一个小于等于 key 的节点
+	node := si.sl.seekNode(key)
+	if node != nil && si.sl.comparator.Compare(node.key, key) == 0 {
+		if value := node.value.Load(); value != nil {
+			si.node, si.value = node, value
+			return
+		}
+	}
+	si.setReverse(si.sl.seekLessNode(key))
+}
+
+func (si *skipListIterator) Next() {
+	if si.node == nil {
+		return
+	}
+	if si.reverse {
+		si.setReverse(si.sl.seekLessNode(si.node.key))
+	} else {
+		si.setForward(si.node.next[0].Load().node)
+	}
+}
+
+// 从 node 开始向后找到第一个没有被删除的节点
+func (si *skipListIterator) setForward(node *skipListNode) {
+	for ; node != nil; node = node.next[0].Load().node {
+		if value := node.value.Load(); value != nil {
+			si.node, si.value = node, value
+			return
+		}
+	}
+	si.node, si.value = nil, nil
+}
+
+// 从 node 开始向前找到第一个没有被删除的节点
+func (si *skipListIterator) setReverse(node *skipListNode) {
+	for node != si.sl.head {
+		if value := node.value.Load(); value != nil {
+			si.node, si.value = node, value
+			return
+		}
+		node = si.sl.seekLessNode(node.key)
+	}
+	si.node, si.value = nil, nil
+}
+
+func (si *skipListIterator) Valid() bool {
+	return si.node != nil
+}
+
+func (si *skipListIterator) Key() []byte {
+	return si.node.key
+}
+
+func (si *skipListIterator) Value() *data.LogRecordPos {
+	return si.value
+}
+
+func (si *skipListIterator) Close() {
+	si.node, si.value = nil, nil
+}
@@ -0,0 +1,153 @@
+package index
+
+import (
+	"bitcask-go/data"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentSkipList_Put(t *testing.T) {
+	sl := NewSkipList(nil)
+
+	res1 := sl.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	assert.Nil(t, res1)
+
+	res2 := sl.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
+	assert.Nil(t, res2)
+
+	res3 := sl.Put([]byte("a"), &data.LogRecordPos{Fid: 11, Offset: 12})
+	assert.Equal(t, uint32(1), res3.Fid)
+	assert.Equal(t, int64(2), res3.Offset)
+	assert.Equal(t, 2, sl.Size())
+}
+
+func TestConcurrentSkipList_Get(t *testing.T) {
+	sl := NewSkipList(nil)
+	sl.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	assert.Equal(t, int64(100), sl.Get(nil).Offset)
+
+	sl.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
+	sl.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 3})
+	assert.Equal(t, int64(3), sl.Get([]byte("a")).Offset)
+	assert.Nil(t, sl.Get([]byte("b")))
+}
+
+func TestConcurrentSkipList_Delete(t *testing.T) {
+	sl := NewSkipList(nil)
+	res1, ok1 := sl.Delete([]byte("not exist"))
+	assert.Nil(t, res1)
+	assert.False(t, ok1)
+
+	sl.Put([]byte("aaa"), &data.LogRecordPos{Fid: 22, Offset: 33})
+	res2, ok2 := sl.Delete([]byte("aaa"))
+	assert.True(t, ok2)
+	assert.Equal(t, int64(33), res2.Offset)
+	assert.Nil(t, sl.Get([]byte("aaa")))
+	assert.Equal(t, 0, sl.Size())
+
+	// 删除之后重新写入
+	assert.Nil(t, sl.Put([]byte("aaa"), &data.LogRecordPos{Fid: 22, Offset: 44}))
+	assert.Equal(t, int64(44), sl.Get([]byte("aaa")).Offset)
+	assert.Equal(t, 1, sl.Size())
+}
+
+func TestConcurrentSkipList_Iterator(t *testing.T) {
+	sl := NewSkipList(nil)
+	iter1 := sl.Iterator(false)
+	iter1.Rewind()
+	assert.False(t, iter1.Valid())
+
+	for _, key := range []string{"ccde", "acee", "eede", "bbcd", "dddd"} {
+		sl.Put([]byte(key), &data.LogRecordPos{Fid: 1, Offset: 10})
+	}
+	sl.Delete([]byte("dddd"))
+
+	var keys []string
+	iter2 := sl.Iterator(false)
+	for iter2.Rewind(); iter2.Valid(); iter2.Next() {
+		assert.NotNil(t, iter2.Value())
+		keys = append(keys, string(iter2.Key()))
+	}
+	assert.Equal(t, []string{"acee", "bbcd", "ccde", "eede"}, keys)
+
+	keys = nil
+	iter3 := sl.Iterator(true)
+	for iter3.Rewind(); iter3.Valid(); iter3.Next() {
+		keys = append(keys, string(iter3.Key()))
+	}
+	assert.Equal(t, []string{"eede", "ccde", "bbcd", "acee"}, keys)
+
+	iter4 := sl.Iterator(false)
+	iter4.Seek([]byte("cc"))
+	assert.Equal(t, "ccde", string(iter4.Key()))
+
+	iter5 := sl.Iterator(true)
+	iter5.Seek([]byte("dddd"))
+	assert.Equal(t, "ccde", string(iter5.Key()))
+	iter5.Seek([]byte("bbcd"))
+	assert.Equal(t, "bbcd", string(iter5.Key()))
+	iter5.Seek([]byte("a"))
+	assert.False(t, iter5.Valid())
+
+	// 遍历的过程中写入的数据
+	iter6 := sl.Iterator(false)
+	iter6.Rewind()
+	sl.Put([]byte("bbbb"), &data.LogRecordPos{Fid: 1, Offset: 10})
+	sl.Delete([]byte("ccde"))
+	keys = nil
+	for ; iter6.Valid(); iter6.Next() {
+		keys = append(keys, string(iter6.Key()))
+	}
+	assert.Equal(t, []string{"acee", "bbbb", "bbcd", "eede"}, keys)
+}
+
+func TestConcurrentSkipList_Concurrent(t *testing.T) {
+	sl := NewSkipList(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				// 每个 key 被两个协程同时写入和删除
+				key := []byte(fmt.Sprintf("key-%d", (n/2*2000+j)%4000))
+				sl.Put(key, &data.LogRecordPos{Fid: uint32(n), Offset: int64(j)})
+				if j%3 == 0 {
+					sl.Delete(key)
+				}
+			}
+			sl.Put([]byte(fmt.Sprintf("key-%d", 8000+n)), &data.LogRecordPos{})
+		}(i)
+	}
+	// 并发遍历时 key 保持有序
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			iter := sl.Iterator(i%2 == 1)
+			var prev []byte
+			for iter.Rewind(); iter.Valid(); iter.Next() {
+				if prev != nil {
+					cmp := BytewiseComparator.Compare(prev, iter.Key())
+					assert.True(t, (i%2 == 0 && cmp < 0) || (i%2 == 1 && cmp > 0))
+				}
+				prev = iter.Key()
+			}
+		}
+	}()
+	wg.Wait()
+
+	// 遍历得到的 key 数量和 Size 一致
+	var count int
+	iter := sl.Iterator(false)
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		assert.Equal(t, iter.Value(), sl.Get(iter.Key()))
+		count++
+	}
+	assert.Equal(t, sl.Size(), count)
+	for i := 0; i < 8; i++ {
+		assert.NotNil(t, sl.Get([]byte(fmt.Sprintf("key-%d", 8000+i))))
+	}
+}
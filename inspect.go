@@ -0,0 +1,223 @@
+package bitcask_go
+
+import (
+	"bitcask-go/data"
+	"bitcask-go/fio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// InspectFileType 被检查的文件类型
+type InspectFileType = string
+
+const (
+	InspectDataFile          InspectFileType = "data"
+	InspectHintFile          InspectFileType = "hint"
+	InspectMergeFinishedFile InspectFileType = "merge-finished"
+	InspectSeqNoFile         InspectFileType = "seq-no"
+	InspectOptionsFile       InspectFileType = "options"
+)
+
+// InspectOptions 检查文件时的配置项
+type InspectOptions struct {
+	// 只输出 key 等于指定值的记录，默认为空表示不过滤
+	Key []byte
+
+	// 是否只输出序列号等于 SeqNo 的记录，带有版本信息的记录使用版本的序列号，其他记录使用事务序列号
+	FilterSeqNo bool
+	SeqNo       uint64
+
+	// value 预览的最大长度，0 表示不输出 value
+	ValuePreviewSize int
+
+	// 文件所在的文件系统，默认是操作系统的文件系统
+	FS fio.VFS
+}
+
+// InspectRecord 从文件中解码出的一条记录
+type InspectRecord struct {
+	File         string             `json:"file"`
+	Offset       int64              `json:"offset"`
+	Size         int64              `json:"size"`
+	Type         string             `json:"type"`
+	Key          string             `json:"key"`
+	SeqNo        uint64             `json:"seq_no"`
+	ValueSize    int                `json:"value_size"`
+	ValuePreview string             `json:"value_preview,omitempty"`
+	Pos          *data.LogRecordPos `json:"pos,omitempty"` // hint 文件中记录的位置索引
+	CRCValid     bool               `json:"crc_valid"`
+	Err          string             `json:"error,omitempty"`
+}
+
+// InspectFile 逐条解码文件中的记录，不需要打开数据库，fn 返回 false 时终止
+// 文件类型根据文件名判断，CRC 校验失败或者不完整的记录也会输出，并从下一个可以解码的位置继续
+func InspectFile(fileName string, opts InspectOptions, fn func(record *InspectRecord) bool) error {
+	fileType, err := inspectFileType(fileName)
+	if err != nil {
+		return err
+	}
+	fs := opts.FS
+	if fs == nil {
+		fs = fio.OSFS{}
+	}
+	// 检查文件是否存在，避免 IOManager 创建出新的文件
+	if _, err := fs.Stat(fileName); err != nil {
+		return err
+	}
+	ioManager, err := fs.OpenFile(fileName, fio.StandardFIO)
+	if err != nil {
+		return err
+	}
+	dataFile := &data.DataFile{IoManager: ioManager}
+	defer dataFile.Close()
+
+	fileSize, err := dataFile.IoManager.Size()
+	if err != nil {
+		return err
+	}
+	var offset int64 = 0
+	for offset < fileSize {
+		logRecord, size, err := dataFile.ReadLogRecord(offset)
+		if err != nil && err != io.EOF && err != data.ErrInvalidCRC {
+			return err
+		}
+		if err == io.EOF {
+			// 剩余的部分全部是 0，说明是正常的文件末尾
+			zero, zeroErr := isZeroRange(dataFile, offset, fileSize)
+			if zeroErr != nil {
+				return zeroErr
+			}
+			if zero {
+				return nil
+			}
+			logRecord, err = nil, errIncompleteRecord
+		}
+
+		record := newInspectRecord(fileName, fileType, offset, size, logRecord, err, opts)
+		if matchInspectRecord(record, logRecord, fileType, opts) && !fn(record) {
+			return nil
+		}
+		if err == nil {
+			offset += size
+			continue
+		}
+		if offset, err = findNextRecord(dataFile, offset+1, fileSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func inspectFileType(fileName string) (InspectFileType, error) {
+	base := filepath.Base(fileName)
+	switch {
+	case strings.HasSuffix(base, data.DataFileNameSuffix):
+		return InspectDataFile, nil
+	case base == data.HintFileName:
+		return InspectHintFile, nil
+	case base == data.MergeFinishedFileName:
+		return InspectMergeFinishedFile, nil
+	case base == data.SeqNoFileName:
+		return InspectSeqNoFile, nil
+	case base == data.OptionsFileName:
+		return InspectOptionsFile, nil
+	}
+	return "", fmt.Errorf("unknown file type of %s", fileName)
+}
+
+func newInspectRecord(fileName string, fileType InspectFileType, offset, size int64,
+	logRecord *data.LogRecord, err error, opts InspectOptions) *InspectRecord {
+	record := &InspectRecord{
+		File:     filepath.Base(fileName),
+		Offset:   offset,
+		Size:     size,
+		CRCValid: err == nil,
+	}
+	if err != nil {
+		record.Err = err.Error()
+	}
+	if logRecord == nil {
+		return record
+	}
+
+	record.Type = logRecordTypeName(logRecord.Type)
+	key := logRecord.Key
+	// 只有数据文件中的 key 带有事务序列号
+	if fileType == InspectDataFile {
+		key, record.SeqNo = parseLogRecordKey(logRecord.Key)
+	}
+	record.Key = printableBytes(key)
+	value := logRecord.Value
+	// 带有版本信息的记录输出版本的序列号和实际的 value，非事务写入时 key 中的序列号总是 0
+	if fileType == InspectDataFile && (logRecord.Type == data.LogRecordVersioned || logRecord.Type == data.LogRecordVersionDeleted) {
+		record.SeqNo, _, value = data.DecodeVersionedValue(value)
+	}
+	record.ValueSize = len(value)
+	if fileType == InspectHintFile {
+		record.Pos = data.DecodeLogRecordPos(logRecord.Value)
+	}
+	if opts.ValuePreviewSize > 0 {
+		if len(value) > opts.ValuePreviewSize {
+			value = value[:opts.ValuePreviewSize]
+		}
+		record.ValuePreview = printableBytes(value)
+	}
+	return record
+}
+
+func matchInspectRecord(record *InspectRecord, logRecord *data.LogRecord, fileType InspectFileType, opts InspectOptions) bool {
+	// 无法解码的记录总是输出
+	if logRecord == nil {
+		return true
+	}
+	if len(opts.Key) > 0 {
+		key := logRecord.Key
+		if fileType == InspectDataFile {
+			key, _ = parseLogRecordKey(key)
+		}
+		if !bytes.Equal(key, opts.Key) {
+			return false
+		}
+	}
+	if opts.FilterSeqNo && record.SeqNo != opts.SeqNo {
+		return false
+	}
+	return true
+}
+
+func logRecordTypeName(typ data.LogRecordType) string {
+	switch typ {
+	case data.LogRecordNormal:
+		return "normal"
+	case data.LogRecordDeleted:
+		return "deleted"
+	case data.LogRecordTxnFinished:
+		return "txn-finished"
+	case data.LogRecordVersioned:
+		return "versioned"
+	case data.LogRecordVersionDeleted:
+		return "version-deleted"
+	}
+	return fmt.Sprintf("unknown(%d)", typ)
+}
+
+// 可以打印的内容原样输出，否则输出十六进制
+func printableBytes(b []byte) string {
+	if utf8.Valid(b) {
+		printable := true
+		for _, r := range string(b) {
+			if r < 0x20 || r == 0x7f {
+				printable = false
+				break
+			}
+		}
+		if printable {
+			return string(b)
+		}
+	}
+	return fmt.Sprintf("0x%x", b)
+}
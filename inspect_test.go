@@ -0,0 +1,156 @@
+package bitcask_go
+
+import (
+	"bitcask-go/data"
+	"bitcask-go/fio"
+	"bitcask-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspectFile(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-inspect")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	err = db.Put(utils.GetTestKey(1), []byte("value-1"))
+	assert.Nil(t, err)
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	_ = wb.Put(utils.GetTestKey(2), []byte{0, 1, 2})
+	assert.Nil(t, wb.Commit())
+
+	var records []*InspectRecord
+	fileName := data.GetDataFileName(dir, 0)
+	err = InspectFile(fileName, InspectOptions{ValuePreviewSize: 5}, func(record *InspectRecord) bool {
+		records = append(records, record)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(records))
+	assert.Equal(t, "normal", records[0].Type)
+	assert.Equal(t, string(utils.GetTestKey(1)), records[0].Key)
+	assert.Equal(t, "value", records[0].ValuePreview)
+	assert.Equal(t, 7, records[0].ValueSize)
+	assert.True(t, records[0].CRCValid)
+	assert.Equal(t, "deleted", records[1].Type)
+	assert.Equal(t, records[0].Size, records[1].Offset)
+	assert.Equal(t, uint64(1), records[2].SeqNo)
+	assert.Equal(t, "0x000102", records[2].ValuePreview)
+	assert.Equal(t, "txn-finished", records[3].Type)
+	assert.Equal(t, string(txnFinKey), records[3].Key)
+
+	// 按照 key 和事务序列号过滤
+	records = nil
+	err = InspectFile(fileName, InspectOptions{Key: utils.GetTestKey(1)}, func(record *InspectRecord) bool {
+		records = append(records, record)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+	records = nil
+	err = InspectFile(fileName, InspectOptions{FilterSeqNo: true, SeqNo: 1}, func(record *InspectRecord) bool {
+		records = append(records, record)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+
+	// CRC 校验失败的记录
+	assert.Nil(t, db.Close())
+	buf, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	buf[0] ^= 0xff
+	assert.Nil(t, os.WriteFile(fileName, buf, fio.DataFilePerm))
+	records = nil
+	err = InspectFile(fileName, InspectOptions{}, func(record *InspectRecord) bool {
+		records = append(records, record)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(records))
+	assert.False(t, records[0].CRCValid)
+	assert.Equal(t, string(utils.GetTestKey(1)), records[0].Key)
+	assert.True(t, records[1].CRCValid)
+
+	// seq-no 文件
+	records = nil
+	err = InspectFile(filepath.Join(dir, data.SeqNoFileName), InspectOptions{ValuePreviewSize: 10}, func(record *InspectRecord) bool {
+		records = append(records, record)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "1", records[0].ValuePreview)
+
+	err = InspectFile(filepath.Join(dir, "unknown"), InspectOptions{}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestInspectFile_Versioned(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-inspect-versioned")
+	opts.DirPath = dir
+	opts.RetainVersions = 2
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.Put(utils.GetTestKey(1), []byte("value-1")))
+	assert.Nil(t, db.Delete(utils.GetTestKey(1)))
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	_ = wb.Put(utils.GetTestKey(2), []byte("value-2"))
+	assert.Nil(t, wb.Commit())
+
+	var records []*InspectRecord
+	fileName := data.GetDataFileName(dir, 0)
+	err = InspectFile(fileName, InspectOptions{ValuePreviewSize: 10}, func(record *InspectRecord) bool {
+		records = append(records, record)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(records))
+	assert.Equal(t, uint64(1), records[0].SeqNo)
+	assert.Equal(t, "value-1", records[0].ValuePreview)
+	assert.Equal(t, uint64(2), records[1].SeqNo)
+	assert.Equal(t, uint64(3), records[2].SeqNo)
+	assert.Equal(t, "value-2", records[2].ValuePreview)
+
+	// 按照版本的序列号过滤
+	records = nil
+	err = InspectFile(fileName, InspectOptions{FilterSeqNo: true, SeqNo: 2}, func(record *InspectRecord) bool {
+		records = append(records, record)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, string(utils.GetTestKey(1)), records[0].Key)
+	assert.Equal(t, logRecordTypeName(data.LogRecordVersionDeleted), records[0].Type)
+}
+
+func TestInspectFile_Hint(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-inspect-hint")
+	defer os.RemoveAll(dir)
+
+	hintFile, err := data.OpenHintFile(fio.OSFS{}, dir)
+	assert.Nil(t, err)
+	pos := &data.LogRecordPos{Fid: 3, Offset: 100, Size: 20}
+	assert.Nil(t, hintFile.WriteHintRecord(utils.GetTestKey(1), pos))
+	assert.Nil(t, hintFile.Close())
+
+	var records []*InspectRecord
+	err = InspectFile(filepath.Join(dir, data.HintFileName), InspectOptions{}, func(record *InspectRecord) bool {
+		records = append(records, record)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, string(utils.GetTestKey(1)), records[0].Key)
+	assert.Equal(t, pos, records[0].Pos)
+}
@@ -13,8 +13,19 @@ type Iterator struct {
 }
 
 // NewIterator 初始化迭代器
+// 迭代器按批次从索引中读取数据，遍历时不会阻塞写入，遍历过程中的修改可能可见也可能不可见，但是 key 保持有序并且不会重复
+// 开启多版本并且指定了 AsOfSeqNo 时，创建迭代器时取出这个序列号时可见的所有 key，遍历的是一个快照
 func (db *DB) NewIterator(opts IteratorOptions) *Iterator {
-	indexIter := db.index.Iterator(opts.Reverse)
+	comparator := db.options.Comparator
+	if comparator == nil {
+		comparator = index.BytewiseComparator
+	}
+	var indexIter index.Iterator
+	if opts.AsOfSeqNo > 0 && db.versioned() {
+		indexIter = db.versionIterator(opts.AsOfSeqNo, opts.Reverse, comparator)
+	} else {
+		indexIter = db.index.Iterator(opts.Reverse)
+	}
 	return &Iterator{
 		db:        db,
 		indexIter: indexIter,
@@ -64,14 +75,14 @@ func (it *Iterator) Close() {
 }
 
 func (it *Iterator) skipToNext() {
-	prefixLen := len(it.options.Prefix)
-	if prefixLen == 0 {
+	if len(it.options.Prefix) == 0 {
 		return
 	}
 
 	for ; it.indexIter.Valid(); it.indexIter.Next() {
 		key := it.indexIter.Key()
-		if prefixLen <= len(key) && bytes.Compare(it.options.Prefix, key[:prefixLen]) == 0 {
+		// 前缀按照字节匹配，比较器只用来决定 key 的顺序
+		if bytes.HasPrefix(key, it.options.Prefix) {
 			break
 		}
 	}
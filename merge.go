@@ -2,22 +2,33 @@ package bitcask_go
 
 import (
 	"bitcask-go/data"
+	"bitcask-go/fio"
+	"bitcask-go/index"
 	"bitcask-go/utils"
+	"context"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"time"
 )
 
 const (
 	mergeDirName     = "-merge"
 	mergeFinishedKey = "merge.finished"
+	hintBatchSize    = 1024 // 加载 hint 文件时每次批量更新索引的数量
 )
 
 // Merge 清理无效数据，生成 Hint 文件
 func (db *DB) Merge() error {
+	return db.MergeWithContext(context.Background(), DefaultMergeOptions)
+}
+
+// MergeWithContext 清理无效数据，生成 Hint 文件
+// 每处理一条记录都会检查 ctx 是否被取消，取消后会清理掉未完成的 merge 目录并返回 ctx 的错误
+func (db *DB) MergeWithContext(ctx context.Context, opts MergeOptions) (err error) {
 	// 如果数据库为空，则直接返回
 	if db.activeFile == nil {
 		return nil
@@ -30,7 +41,8 @@ func (db *DB) Merge() error {
 	}
 
 	// 查看可以 merge 的数据量是否达到了阈值
-	totalSize, err := utils.DirSize(db.options.DirPath)
+	db.expireVersions(time.Now())
+	totalSize, err := fio.DirSize(db.options.FS, db.options.DirPath)
 	if err != nil {
 		db.mu.Unlock()
 		return err
@@ -41,7 +53,7 @@ func (db *DB) Merge() error {
 	}
 
 	// 查看剩余的空间容量是否可以容纳 merge 之后的数据量
-	availableDiskSize, err := utils.AvailableDiskSize()
+	availableDiskSize, err := db.options.FS.AvailableSpace(db.options.DirPath)
 	if err != nil {
 		db.mu.Unlock()
 		return err
@@ -55,9 +67,14 @@ func (db *DB) Merge() error {
 	defer func() {
 		db.isMerging = false
 	}()
+	defer db.observeOp(MetricMergeTotal, MetricMergeDuration, time.Now())
 
-	// 持久化当前活跃文件
-	if err := db.activeFile.Sync(); err != nil {
+	// 去掉预分配的部分并持久化当前活跃文件
+	if err := db.trimActiveFile(); err != nil {
+		db.mu.Unlock()
+		return err
+	}
+	if err := db.syncActiveFile(); err != nil {
 		db.mu.Unlock()
 		return err
 	}
@@ -66,7 +83,7 @@ func (db *DB) Merge() error {
 	// 打开新的活跃文件
 	if err := db.setActiveDataFile(); err != nil {
 		db.mu.Unlock()
-		return nil
+		return err
 	}
 	// 记录最近没有参与 merge 的文件 id
 	nonMergeFileId := db.activeFile.FileId
@@ -76,42 +93,94 @@ func (db *DB) Merge() error {
 	for _, file := range db.olderFiles {
 		mergeFiles = append(mergeFiles, file)
 	}
-	db.mu.Unlock()
-
 	//	待 merge 的文件从小到大进行排序，依次 merge
 	sort.Slice(mergeFiles, func(i, j int) bool {
 		return mergeFiles[i].FileId < mergeFiles[j].FileId
 	})
 
+	// 在持有锁时记录开始的信息，之后的写入会继续修改 reclaimSize
+	beginInfo := MergeBeginInfo{ReclaimBytes: db.reclaimSize, NonMergeFileId: nonMergeFileId}
+	for _, file := range mergeFiles {
+		size, err := file.IoManager.Size()
+		if err != nil {
+			db.mu.Unlock()
+			return err
+		}
+		beginInfo.FileIds = append(beginInfo.FileIds, file.FileId)
+		beginInfo.TotalBytes += size
+	}
+	db.mu.Unlock()
+	db.options.EventListener.OnMergeBegin(beginInfo)
+
+	progress := MergeProgressInfo{FilesTotal: len(mergeFiles)}
+	startTime := time.Now()
+	defer func() {
+		db.options.Metrics.IncCounter(MetricMergeBytesRead, uint64(progress.BytesScanned))
+		db.options.Metrics.IncCounter(MetricMergeBytesWritten, uint64(progress.BytesKept))
+		db.options.EventListener.OnMergeEnd(MergeEndInfo{
+			FilesMerged:  progress.FilesDone,
+			BytesScanned: progress.BytesScanned,
+			BytesKept:    progress.BytesKept,
+			Duration:     time.Since(startTime),
+			Err:          err,
+		})
+	}()
+
 	mergePath := db.getMergePath()
 	// 如果目录存在，说明发生过 merge，将其删除掉
-	if _, err := os.Stat(mergePath); err == nil {
-		if err := os.RemoveAll(mergePath); err != nil {
+	if _, err := db.options.FS.Stat(mergePath); err == nil {
+		if err := db.options.FS.RemoveAll(mergePath); err != nil {
 			return err
 		}
 	}
 	// 新建一个 merge path 的目录
-	if err := os.MkdirAll(mergePath, os.ModePerm); err != nil {
+	if err := db.options.FS.MkdirAll(mergePath); err != nil {
 		return err
 	}
+	defer func() {
+		// merge 被取消或者失败，清理掉不完整的 merge 目录
+		if err != nil {
+			_ = db.options.FS.RemoveAll(mergePath)
+		}
+	}()
 	// 打开一个新的临时 bitcask 实例
 	mergeOptions := db.options
 	mergeOptions.DirPath = mergePath
 	mergeOptions.SyncWrites = false
+	mergeOptions.SyncInterval = 0
+	// 临时实例只用来写数据文件，不需要磁盘上的索引，B+ 树的索引文件不能被移动到数据目录中
+	mergeOptions.IndexType = BTree
+	// 临时实例的事件不需要通知给用户，读写的数据量通过 merge 的指标单独上报
+	mergeOptions.EventListener = NopEventListener{}
+	mergeOptions.Metrics = nopMetrics{}
 	mergeDB, err := Open(mergeOptions)
 	if err != nil {
 		return err
 	}
 
 	// 打开 hint 文件存储索引
-	hintFile, err := data.OpenHintFile(mergePath)
+	hintFile, err := data.OpenHintFile(db.options.FS, mergePath)
 	if err != nil {
+		_ = mergeDB.Close()
 		return err
 	}
+	defer func() {
+		_ = hintFile.Close()
+		_ = mergeDB.Close()
+	}()
+
+	limiter := utils.NewRateLimiter(opts.RateLimit)
 	// 遍历处理每个数据文件
 	for _, dataFile := range mergeFiles {
 		var offset int64 = 0
 		for {
+			// 每条记录之间检查是否被取消
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+
 			logRecord, size, err := dataFile.ReadLogRecord(offset)
 			if err != nil {
 				if err == io.EOF {
@@ -119,27 +188,50 @@ func (db *DB) Merge() error {
 				}
 				return err
 			}
+			ioBytes := size
 			// 解析拿到实际的 key
 			realKey, _ := parseLogRecordKey(logRecord.Key)
 			logRecordPos := db.index.Get(realKey)
 			// 和内存中的索引位置进行比较，如果有效则重写
-			if logRecordPos != nil &&
+			latest := logRecordPos != nil &&
 				logRecordPos.Fid == dataFile.FileId &&
-				logRecordPos.Offset == offset {
-				// 清除事务标记
+				logRecordPos.Offset == offset
+			// 开启多版本时保留按照保留策略需要保留的所有版本，包括删除操作
+			retained := latest
+			if db.versioned() {
+				retained = db.versionRetained(realKey, &data.LogRecordPos{Fid: dataFile.FileId, Offset: offset})
+			}
+			if retained {
+				// 清除事务标记，版本信息保存在 value 中，不受影响
 				logRecord.Key = logRecordKeyWithSeq(realKey, nonTransactionSeqNo)
-				pos, err := mergeDB.appendLogRecord(logRecord)
+				pos, err := mergeDB.appendLogRecord(logRecord, DefaultWriteOptions)
 				if err != nil {
 					return err
 				}
-				// 将当前位置索引写到 Hint 文件当中
-				if err := hintFile.WriteHintRecord(realKey, pos); err != nil {
-					return err
+				// 将最新版本的位置索引写到 Hint 文件当中
+				if latest {
+					if err := hintFile.WriteHintRecord(realKey, pos); err != nil {
+						return err
+					}
 				}
+				progress.BytesKept += int64(pos.Size)
+				ioBytes += int64(pos.Size)
 			}
 			// 增加 offset
 			offset += size
+			progress.BytesScanned += size
+
+			// 限制 merge 的读写速率，避免影响前台的读写
+			if err := limiter.Wait(ctx, ioBytes); err != nil {
+				return err
+			}
+		}
+		progress.FileId = dataFile.FileId
+		progress.FilesDone++
+		if opts.Progress != nil {
+			opts.Progress(progress)
 		}
+		db.options.EventListener.OnMergeProgress(progress)
 	}
 
 	// sync 保证持久化
@@ -151,7 +243,7 @@ func (db *DB) Merge() error {
 	}
 
 	// 写标识 merge 完成的文件
-	mergeFinishedFile, err := data.OpenMergeFinishedFile(mergePath)
+	mergeFinishedFile, err := data.OpenMergeFinishedFile(db.options.FS, mergePath)
 	if err != nil {
 		return err
 	}
@@ -164,15 +256,21 @@ func (db *DB) Merge() error {
 		return err
 	}
 	if err := mergeFinishedFile.Sync(); err != nil {
+		_ = mergeFinishedFile.Close()
 		return err
 	}
 
-	return nil
+	return mergeFinishedFile.Close()
 }
 
 func (db *DB) getMergePath() string {
-	dir := path.Dir(path.Clean(db.options.DirPath))
-	base := path.Base(db.options.DirPath)
+	return getMergePath(db.options.DirPath)
+}
+
+// 获取数据目录对应的 merge 目录
+func getMergePath(dirPath string) string {
+	dir := path.Dir(path.Clean(dirPath))
+	base := path.Base(dirPath)
 	return filepath.Join(dir, base+mergeDirName)
 }
 
@@ -180,14 +278,14 @@ func (db *DB) getMergePath() string {
 func (db *DB) loadMergeFiles() error {
 	mergePath := db.getMergePath()
 	// merge 目录不存在的话直接返回
-	if _, err := os.Stat(mergePath); os.IsNotExist(err) {
+	if _, err := db.options.FS.Stat(mergePath); os.IsNotExist(err) {
 		return nil
 	}
 	defer func() {
-		_ = os.RemoveAll(mergePath)
+		_ = db.options.FS.RemoveAll(mergePath)
 	}()
 
-	dirEntries, err := os.ReadDir(mergePath)
+	dirEntries, err := db.options.FS.ReadDir(mergePath)
 	if err != nil {
 		return err
 	}
@@ -199,10 +297,10 @@ func (db *DB) loadMergeFiles() error {
 		if entry.Name() == data.MergeFinishedFileName {
 			mergeFinished = true
 		}
-		if entry.Name() == data.SeqNoFileName {
+		if entry.Name() == data.SeqNoFileName || entry.Name() == data.OptionsFileName {
 			continue
 		}
-		if entry.Name() == fileLockName {
+		if entry.Name() == fileLockName || entry.Name() == index.BPlusTreeFileName {
 			continue
 		}
 		mergeFileNames = append(mergeFileNames, entry.Name())
@@ -218,12 +316,19 @@ func (db *DB) loadMergeFiles() error {
 		return nil
 	}
 
+	// B+ 树索引在替换数据文件之前更新，中途崩溃时下次打开会重新替换数据文件
+	if db.options.IndexType == BPlusTree {
+		if err := db.applyMergeToBPlusTree(mergePath, nonMergeFileId); err != nil {
+			return err
+		}
+	}
+
 	// 删除旧的数据文件
 	var fileId uint32 = 0
 	for ; fileId < nonMergeFileId; fileId++ {
 		fileName := data.GetDataFileName(db.options.DirPath, fileId)
-		if _, err := os.Stat(fileName); err == nil {
-			if err := os.Remove(fileName); err != nil {
+		if _, err := db.options.FS.Stat(fileName); err == nil {
+			if err := db.options.FS.Remove(fileName); err != nil {
 				return err
 			}
 		}
@@ -233,15 +338,16 @@ func (db *DB) loadMergeFiles() error {
 	for _, fileName := range mergeFileNames {
 		srcPath := filepath.Join(mergePath, fileName)
 		destPath := filepath.Join(db.options.DirPath, fileName)
-		if err := os.Rename(srcPath, destPath); err != nil {
+		if err := db.options.FS.Rename(srcPath, destPath); err != nil {
 			return err
 		}
 	}
+	db.recovery.MergeApplied = true
 	return nil
 }
 
 func (db *DB) getNonMergeFileId(dirPath string) (uint32, error) {
-	mergeFinishedFile, err := data.OpenMergeFinishedFile(dirPath)
+	mergeFinishedFile, err := data.OpenMergeFinishedFile(db.options.FS, dirPath)
 	if err != nil {
 		return 0, err
 	}
@@ -256,35 +362,76 @@ func (db *DB) getNonMergeFileId(dirPath string) (uint32, error) {
 	return uint32(nonMergeFileId), nil
 }
 
+// 将 merge 目录中 hint 文件的索引替换到 B+ 树索引中
+// B+ 树索引已经应用过这次 merge 时直接返回，保证替换数据文件的过程中崩溃之后可以重新执行
+func (db *DB) applyMergeToBPlusTree(mergePath string, nonMergeFileId uint32) error {
+	bpt := db.index.(*index.BPlusTree)
+	if meta, _ := bpt.Meta(); meta.MergeFid == nonMergeFileId {
+		return nil
+	}
+
+	var keys [][]byte
+	var positions []*data.LogRecordPos
+	if err := db.readHintFile(mergePath, func(key []byte, pos *data.LogRecordPos) {
+		keys = append(keys, key)
+		positions = append(positions, pos)
+	}); err != nil {
+		return err
+	}
+	return bpt.ApplyMerge(nonMergeFileId, keys, positions)
+}
+
 // 从 hint 文件中加载索引
 func (db *DB) loadIndexFromHintFile() error {
+	// 读取文件中的索引，批量更新到索引中
+	var keys [][]byte
+	var positions []*data.LogRecordPos
+	if err := db.readHintFile(db.options.DirPath, func(key []byte, pos *data.LogRecordPos) {
+		keys = append(keys, key)
+		positions = append(positions, pos)
+		if len(keys) == hintBatchSize {
+			db.index.PutBatch(keys, positions)
+			keys, positions = nil, nil
+		}
+		db.recovery.HintRecords++
+	}); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		db.index.PutBatch(keys, positions)
+	}
+	return nil
+}
+
+// 依次读取 dirPath 目录中 hint 文件的每一条索引，文件不存在时直接返回
+func (db *DB) readHintFile(dirPath string, fn func(key []byte, pos *data.LogRecordPos)) error {
 	// 查看 hint 索引文件是否存在
-	hintFileName := filepath.Join(db.options.DirPath, data.HintFileName)
-	if _, err := os.Stat(hintFileName); os.IsNotExist(err) {
+	hintFileName := filepath.Join(dirPath, data.HintFileName)
+	if _, err := db.options.FS.Stat(hintFileName); os.IsNotExist(err) {
 		return nil
 	}
 
 	//	打开 hint 索引文件
-	hintFile, err := data.OpenHintFile(db.options.DirPath)
+	hintFile, err := data.OpenHintFile(db.options.FS, dirPath)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = hintFile.Close()
+	}()
 
-	// 读取文件中的索引
 	var offset int64 = 0
 	for {
 		logRecord, size, err := hintFile.ReadLogRecord(offset)
 		if err != nil {
 			if err == io.EOF {
-				break
+				return nil
 			}
 			return err
 		}
 
 		// 解码拿到实际的位置索引
-		pos := data.DecodeLogRecordPos(logRecord.Value)
-		db.index.Put(logRecord.Key, pos)
+		fn(logRecord.Key, data.DecodeLogRecordPos(logRecord.Value))
 		offset += size
 	}
-	return nil
 }
@@ -1,11 +1,19 @@
 package bitcask_go
 
 import (
+	"bitcask-go/data"
+	"bitcask-go/fio"
 	"bitcask-go/utils"
+	"context"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 // 没有任何数据的情况下进行 merge
@@ -201,3 +209,231 @@ func TestDB_Merge5(t *testing.T) {
 		assert.NotNil(t, val)
 	}
 }
+
+// 每种索引 merge 之后重启，B+ 树索引中的位置要和替换之后的数据文件一致
+func TestDB_MergeIndexTypes(t *testing.T) {
+	for _, indexType := range []IndexerType{BTree, ART, BPlusTree, Hash, SkipList} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-merge-index")
+		opts.DirPath = dir
+		opts.DataFileSize = 64 * 1024
+		opts.DataFileMergeRatio = 0
+		opts.IndexType = indexType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		for i := 0; i < 2000; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), []byte(fmt.Sprintf("value-%d", i))))
+		}
+		// 一部分 key 被覆盖或者删除
+		for i := 0; i < 500; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), []byte(fmt.Sprintf("new-value-%d", i))))
+		}
+		for i := 500; i < 1000; i++ {
+			assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+		}
+		assert.Nil(t, db.Merge())
+
+		// merge 之后写入的数据
+		assert.Nil(t, db.Put(utils.GetTestKey(1000), []byte("after-merge")))
+		assert.Nil(t, db.Delete(utils.GetTestKey(1001)))
+		assert.Nil(t, db.Put(utils.GetTestKey(2000), []byte("value-2000")))
+		assert.Nil(t, db.Close())
+
+		check := func(db *DB) {
+			assert.Equal(t, 1500, len(db.ListKeys()))
+			for i := 0; i <= 2000; i++ {
+				val, err := db.Get(utils.GetTestKey(i))
+				switch {
+				case i < 500:
+					assert.Equal(t, fmt.Sprintf("new-value-%d", i), string(val))
+				case i < 1000 || i == 1001:
+					assert.Equal(t, ErrKeyNotFound, err)
+				case i == 1000:
+					assert.Equal(t, "after-merge", string(val))
+				default:
+					assert.Equal(t, fmt.Sprintf("value-%d", i), string(val))
+				}
+			}
+		}
+
+		// 第一次打开时替换数据文件，第二次打开时直接使用替换之后的数据文件
+		for n := 0; n < 2; n++ {
+			db, err = Open(opts)
+			assert.Nil(t, err)
+			assert.Equal(t, n == 0, db.recovery.MergeApplied)
+			check(db)
+			assert.Nil(t, db.Close())
+		}
+		assert.Nil(t, os.RemoveAll(dir))
+	}
+}
+
+// B+ 树索引已经应用了 merge，移动 hint 文件之后崩溃，重新打开时不能再次应用 merge
+func TestDB_MergeBPlusTreeReapply(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-bptree")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.IndexType = BPlusTree
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i%1000), []byte(fmt.Sprintf("value-%d", i))))
+	}
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	// 保留一份 merge 目录，去掉已经移动到数据目录中的 hint 文件
+	mergeBackup, _ := os.MkdirTemp("", "bitcask-go-merge-bptree-backup")
+	defer func() {
+		_ = os.RemoveAll(mergeBackup)
+	}()
+	assert.Nil(t, fio.CopyDir(fio.OSFS{}, getMergePath(dir), mergeBackup, []string{data.HintFileName}))
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+	assert.Nil(t, fio.CopyDir(fio.OSFS{}, mergeBackup, getMergePath(dir), nil))
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.True(t, db.recovery.MergeApplied)
+	assert.Equal(t, 1000, len(db.ListKeys()))
+	for i := 0; i < 1000; i++ {
+		val, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("value-%d", i+1000), string(val))
+	}
+}
+
+// merge 的过程中被取消
+func TestDB_MergeWithContext_Cancel(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-cancel")
+	opts.DataFileSize = 4 * 1024 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 20000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(1024))
+		assert.Nil(t, err)
+	}
+
+	// 处理完第一个文件之后取消
+	ctx, cancel := context.WithCancel(context.Background())
+	mergeOpts := DefaultMergeOptions
+	mergeOpts.Progress = func(info MergeProgressInfo) {
+		cancel()
+	}
+	err = db.MergeWithContext(ctx, mergeOpts)
+	assert.Equal(t, context.Canceled, err)
+	_, err = os.Stat(db.getMergePath())
+	assert.True(t, os.IsNotExist(err))
+
+	// 取消之后可以再次 merge
+	var infos []MergeProgressInfo
+	mergeOpts.Progress = func(info MergeProgressInfo) {
+		infos = append(infos, info)
+	}
+	err = db.MergeWithContext(context.Background(), mergeOpts)
+	assert.Nil(t, err)
+	assert.True(t, len(infos) > 1)
+	last := infos[len(infos)-1]
+	assert.Equal(t, last.FilesTotal, last.FilesDone)
+	assert.True(t, last.BytesScanned >= last.BytesKept)
+	assert.True(t, last.BytesKept > 0)
+
+	// 重启校验
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 20000, len(db2.ListKeys()))
+}
+
+// merge 限速
+func TestDB_MergeWithContext_RateLimit(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-rate-limit")
+	opts.DataFileSize = 256 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(512))
+		assert.Nil(t, err)
+	}
+
+	// 扫描和重写一共大约 1MB 的数据，限速 4MB/s
+	mergeOpts := DefaultMergeOptions
+	mergeOpts.RateLimit = 4 * 1024 * 1024
+	now := time.Now()
+	err = db.MergeWithContext(context.Background(), mergeOpts)
+	assert.Nil(t, err)
+	assert.True(t, time.Since(now) >= 150*time.Millisecond)
+}
+
+// 打开指定的文件或者目录锁时返回错误的文件系统
+type failOpenFS struct {
+	fio.VFS
+	fail func(name string) bool
+}
+
+var errOpenFailed = fmt.Errorf("open failed")
+
+func (fs failOpenFS) OpenFile(name string, ioType fio.FileIOType) (fio.IOManager, error) {
+	if fs.fail(name) {
+		return nil, errOpenFailed
+	}
+	return fs.VFS.OpenFile(name, ioType)
+}
+
+func (fs failOpenFS) Lock(name string) (io.Closer, error) {
+	if fs.fail(name) {
+		return nil, errOpenFailed
+	}
+	return fs.VFS.Lock(name)
+}
+
+// 打开临时实例或者 hint 文件失败时返回错误，并清理掉 merge 目录
+func TestDB_Merge_OpenFailed(t *testing.T) {
+	for _, name := range []string{fileLockName, data.HintFileName} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "bitcask-go-merge-open-failed")
+		opts.DirPath = dir
+		opts.DataFileMergeRatio = 0
+		failing := false
+		mergePath := getMergePath(dir)
+		opts.FS = failOpenFS{VFS: fio.OSFS{}, fail: func(path string) bool {
+			return failing && strings.HasPrefix(path, mergePath) && filepath.Base(path) == name
+		}}
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+		}
+		failing = true
+		assert.Equal(t, errOpenFailed, db.Merge(), name)
+		_, err = os.Stat(mergePath)
+		assert.True(t, os.IsNotExist(err), name)
+
+		failing = false
+		assert.Nil(t, db.Merge())
+		assert.Equal(t, 100, len(db.ListKeys()))
+		destroyDB(db)
+	}
+}
@@ -0,0 +1,47 @@
+package bitcask_go
+
+import "time"
+
+// Metrics 指标收集接口，存储引擎在关键路径上通过它上报计数和耗时
+// 可以接入 Prometheus 等监控系统，默认不做任何处理
+type Metrics interface {
+	// IncCounter 将名称为 name 的计数器累加 delta
+	IncCounter(name string, delta uint64)
+
+	// Observe 向名称为 name 的直方图中记录一次观测值，耗时类指标以秒为单位
+	Observe(name string, value float64)
+}
+
+// 存储引擎上报的指标名称
+const (
+	MetricPutTotal          = "bitcask_put_total"
+	MetricPutDuration       = "bitcask_put_duration_seconds"
+	MetricGetTotal          = "bitcask_get_total"
+	MetricGetDuration       = "bitcask_get_duration_seconds"
+	MetricDeleteTotal       = "bitcask_delete_total"
+	MetricDeleteDuration    = "bitcask_delete_duration_seconds"
+	MetricBytesWritten      = "bitcask_written_bytes_total"
+	MetricBytesRead         = "bitcask_read_bytes_total"
+	MetricFsyncTotal        = "bitcask_fsync_total"
+	MetricFsyncDuration     = "bitcask_fsync_duration_seconds"
+	MetricFileRotations     = "bitcask_file_rotations_total"
+	MetricMergeTotal        = "bitcask_merge_total"
+	MetricMergeDuration     = "bitcask_merge_duration_seconds"
+	MetricMergeBytesRead    = "bitcask_merge_read_bytes_total"
+	MetricMergeBytesWritten = "bitcask_merge_written_bytes_total"
+	MetricBatchCommitSize   = "bitcask_batch_commit_records"
+	MetricBatchCommitsTotal = "bitcask_batch_commit_total"
+)
+
+// 默认的指标收集实现，不做任何处理
+type nopMetrics struct{}
+
+func (nopMetrics) IncCounter(string, uint64) {}
+
+func (nopMetrics) Observe(string, float64) {}
+
+// 记录一次操作的次数和耗时
+func (db *DB) observeOp(counter, histogram string, start time.Time) {
+	db.options.Metrics.IncCounter(counter, 1)
+	db.options.Metrics.Observe(histogram, time.Since(start).Seconds())
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// DefaultDurationBuckets 耗时类直方图的默认分桶，单位为秒
+	DefaultDurationBuckets = []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5, 10}
+
+	// DefaultSizeBuckets 数量类直方图的默认分桶
+	DefaultSizeBuckets = []float64{1, 2, 5, 10, 50, 100, 500, 1000, 5000, 10000}
+)
+
+// Prometheus 将指标保存在内存中，并以 Prometheus 文本格式导出
+// 同时实现了 bitcask 的 Metrics 接口和 http.Handler 接口
+type Prometheus struct {
+	mu         sync.Mutex
+	counters   map[string]uint64
+	histograms map[string]*histogram
+	buckets    map[string][]float64 // 用户为某个直方图单独指定的分桶
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64 // 每个分桶中的观测次数，不累加
+	count  uint64
+	sum    float64
+}
+
+// NewPrometheus 初始化 Prometheus 指标导出器
+func NewPrometheus() *Prometheus {
+	return &Prometheus{
+		counters:   make(map[string]uint64),
+		histograms: make(map[string]*histogram),
+		buckets:    make(map[string][]float64),
+	}
+}
+
+// SetBuckets 为名称为 name 的直方图指定分桶，需要在第一次观测之前调用
+// 未指定时，以 _seconds 结尾的指标使用 DefaultDurationBuckets，其余使用 DefaultSizeBuckets
+func (p *Prometheus) SetBuckets(name string, buckets []float64) {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	p.mu.Lock()
+	p.buckets[name] = sorted
+	p.mu.Unlock()
+}
+
+func (p *Prometheus) IncCounter(name string, delta uint64) {
+	p.mu.Lock()
+	p.counters[name] += delta
+	p.mu.Unlock()
+}
+
+func (p *Prometheus) Observe(name string, value float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.histograms[name]
+	if !ok {
+		bounds, ok := p.buckets[name]
+		if !ok {
+			bounds = DefaultSizeBuckets
+			if strings.HasSuffix(name, "_seconds") {
+				bounds = DefaultDurationBuckets
+			}
+		}
+		h = &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+		p.histograms[name] = h
+	}
+	idx := sort.SearchFloat64s(h.bounds, value)
+	if idx < len(h.counts) {
+		h.counts[idx]++
+	}
+	h.count++
+	h.sum += value
+}
+
+// WriteTo 以 Prometheus 文本格式输出所有指标
+func (p *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+
+	p.mu.Lock()
+	counterNames := make([]string, 0, len(p.counters))
+	for name := range p.counters {
+		counterNames = append(counterNames, name)
+	}
+	sort.Strings(counterNames)
+	for _, name := range counterNames {
+		fmt.Fprintf(&sb, "# TYPE %s counter\n", name)
+		fmt.Fprintf(&sb, "%s %d\n", name, p.counters[name])
+	}
+
+	histogramNames := make([]string, 0, len(p.histograms))
+	for name := range p.histograms {
+		histogramNames = append(histogramNames, name)
+	}
+	sort.Strings(histogramNames)
+	for _, name := range histogramNames {
+		h := p.histograms[name]
+		fmt.Fprintf(&sb, "# TYPE %s histogram\n", name)
+		// Prometheus 的分桶计数是累加的
+		var cumulative uint64
+		for i, bound := range h.bounds {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&sb, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(&sb, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+		fmt.Fprintf(&sb, "%s_sum %s\n", name, formatFloat(h.sum))
+		fmt.Fprintf(&sb, "%s_count %d\n", name, h.count)
+	}
+	p.mu.Unlock()
+
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+// ServeHTTP 可以直接挂载到 http 服务的 /metrics 路径上
+func (p *Prometheus) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = p.WriteTo(writer)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
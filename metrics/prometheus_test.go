@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheus_IncCounter(t *testing.T) {
+	p := NewPrometheus()
+	p.IncCounter("bitcask_put_total", 1)
+	p.IncCounter("bitcask_put_total", 2)
+
+	var sb strings.Builder
+	_, err := p.WriteTo(&sb)
+	assert.Nil(t, err)
+	assert.Contains(t, sb.String(), "# TYPE bitcask_put_total counter\n")
+	assert.Contains(t, sb.String(), "bitcask_put_total 3\n")
+}
+
+func TestPrometheus_Observe(t *testing.T) {
+	p := NewPrometheus()
+	p.Observe("bitcask_put_duration_seconds", 0.00002)
+	p.Observe("bitcask_put_duration_seconds", 20)
+
+	p.SetBuckets("batch_records", []float64{100, 10})
+	p.Observe("batch_records", 5)
+	p.Observe("batch_records", 50)
+
+	var sb strings.Builder
+	_, err := p.WriteTo(&sb)
+	assert.Nil(t, err)
+	out := sb.String()
+	assert.Contains(t, out, "# TYPE bitcask_put_duration_seconds histogram\n")
+	assert.Contains(t, out, "bitcask_put_duration_seconds_bucket{le=\"1e-05\"} 0\n")
+	assert.Contains(t, out, "bitcask_put_duration_seconds_bucket{le=\"5e-05\"} 1\n")
+	assert.Contains(t, out, "bitcask_put_duration_seconds_bucket{le=\"10\"} 1\n")
+	assert.Contains(t, out, "bitcask_put_duration_seconds_bucket{le=\"+Inf\"} 2\n")
+	assert.Contains(t, out, "bitcask_put_duration_seconds_count 2\n")
+
+	assert.Contains(t, out, "batch_records_bucket{le=\"10\"} 1\n")
+	assert.Contains(t, out, "batch_records_bucket{le=\"100\"} 2\n")
+	assert.Contains(t, out, "batch_records_sum 55\n")
+}
+
+func TestPrometheus_ServeHTTP(t *testing.T) {
+	p := NewPrometheus()
+	p.IncCounter("bitcask_get_total", 10)
+
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "bitcask_get_total 10")
+
+	recorder = httptest.NewRecorder()
+	p.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,110 @@
+package bitcask_go
+
+import (
+	"bitcask-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+)
+
+// 测试使用的指标收集器，记录所有上报的指标
+type testMetrics struct {
+	mu       sync.Mutex
+	counters map[string]uint64
+	observed map[string][]float64
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{
+		counters: make(map[string]uint64),
+		observed: make(map[string][]float64),
+	}
+}
+
+func (tm *testMetrics) IncCounter(name string, delta uint64) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.counters[name] += delta
+}
+
+func (tm *testMetrics) Observe(name string, value float64) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.observed[name] = append(tm.observed[name], value)
+}
+
+func TestDB_Metrics(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-metrics")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	opts.SyncWrites = true
+	metrics := newTestMetrics()
+	opts.Metrics = metrics
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 500; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	_ = wb.Put(utils.GetTestKey(1), utils.RandomValue(10))
+	_ = wb.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	err = wb.Commit()
+	assert.Nil(t, err)
+
+	assert.Equal(t, uint64(500), metrics.counters[MetricPutTotal])
+	assert.Equal(t, 500, len(metrics.observed[MetricPutDuration]))
+	assert.Equal(t, uint64(1), metrics.counters[MetricGetTotal])
+	assert.Equal(t, uint64(1), metrics.counters[MetricDeleteTotal])
+	assert.True(t, metrics.counters[MetricBytesWritten] > 500*128)
+	assert.True(t, metrics.counters[MetricBytesRead] > 128)
+	assert.True(t, metrics.counters[MetricFsyncTotal] >= 500)
+	assert.Equal(t, uint64(len(db.olderFiles)), metrics.counters[MetricFileRotations])
+	assert.Equal(t, uint64(1), metrics.counters[MetricBatchCommitsTotal])
+	assert.Equal(t, []float64{2}, metrics.observed[MetricBatchCommitSize])
+}
+
+func TestDB_MergeMetrics(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-metrics")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	opts.DataFileMergeRatio = 0
+	metrics := newTestMetrics()
+	opts.Metrics = metrics
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i%500), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	bytesWritten := metrics.counters[MetricBytesWritten]
+	rotations := metrics.counters[MetricFileRotations]
+	var totalSize int64
+	for _, dataFile := range db.olderFiles {
+		totalSize += dataFile.WriteOff
+	}
+	totalSize += db.activeFile.WriteOff
+
+	// merge 时的读写通过单独的指标上报，不计入用户的读写
+	assert.Nil(t, db.Merge())
+	assert.Equal(t, uint64(1000), metrics.counters[MetricPutTotal])
+	assert.Equal(t, bytesWritten, metrics.counters[MetricBytesWritten])
+	assert.Equal(t, rotations, metrics.counters[MetricFileRotations])
+	assert.Equal(t, uint64(1), metrics.counters[MetricMergeTotal])
+	assert.Equal(t, uint64(totalSize), metrics.counters[MetricMergeBytesRead])
+	assert.True(t, metrics.counters[MetricMergeBytesWritten] > 500*128)
+	assert.True(t, metrics.counters[MetricMergeBytesWritten] < uint64(totalSize))
+}
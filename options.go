@@ -1,6 +1,11 @@
 package bitcask_go
 
-import "os"
+import (
+	"bitcask-go/fio"
+	"bitcask-go/index"
+	"os"
+	"time"
+)
 
 type Options struct {
 	// 数据库数据目录
@@ -21,8 +26,58 @@ type Options struct {
 	// 启动时是否使用 MMap 加载数据
 	MMapAtStartup bool
 
+	// 数据文件读写使用的 IO 类型，MemoryMap 表示读写都使用内存文件映射
+	// DirectIO 和 DSyncIO 的写入绕过页缓存或者同步持久化，写延迟更稳定
+	IOType fio.FileIOType
+
 	//	数据文件合并的阈值
 	DataFileMergeRatio float32
+
+	// 指标收集器，默认不收集任何指标
+	Metrics Metrics
+
+	// 存储引擎内部事件的监听器，默认不做任何处理
+	EventListener EventListener
+
+	// 磁盘剩余空间的最小值，低于这个值时拒绝写入，0 表示不检查
+	MinFreeDiskBytes uint64
+
+	// 后台检查磁盘剩余空间的时间间隔
+	DiskCheckInterval time.Duration
+
+	// key 的最大长度，0 表示只受数据文件大小的限制
+	MaxKeySize uint32
+
+	// value 的最大长度，0 表示只受数据文件大小的限制
+	MaxValueSize uint32
+
+	// 后台定期持久化活跃文件的时间间隔，0 表示不开启
+	SyncInterval time.Duration
+
+	// 活跃文件每次预分配的磁盘空间大小，0 表示不预分配
+	// 大于等于 DataFileSize 时创建活跃文件时一次预分配整个文件，持久化时不需要再更新文件大小
+	PreallocateSize int64
+
+	// 数据目录使用的文件系统，打开、读取目录、重命名、删除、文件锁和剩余空间的检查都通过它完成
+	// 默认是操作系统的文件系统，使用 fio.NewMemFS() 时数据只保存在内存中，B+ 树索引只支持操作系统的文件系统
+	FS fio.VFS
+
+	// key 的比较器，决定索引和迭代器中 key 的顺序，默认按照字节序排序
+	// ART 和 BPlusTree 索引不支持自定义的比较器，比较器的名称会被记录到数据目录中，之后打开时必须使用同名的比较器
+	Comparator index.Comparator
+
+	// B+ 树索引异步批量提交更新时缓存的最大更新数量，0 表示每次更新都直接提交到索引文件
+	// 异步模式下崩溃会丢失还没有提交的索引更新，打开时从索引文件记录的位置开始重放数据文件
+	BPlusTreeAsyncBatchSize int
+
+	// 每个 key 保留最近的多少个版本，0 表示不按照数量保留历史版本
+	// RetainVersions 和 RetainVersionAge 都为 0 时不开启多版本，只保留最新的数据
+	RetainVersions int
+
+	// 每个 key 保留写入时间在多长时间之内的版本，0 表示不按照时间保留历史版本
+	// 两个条件都设置时，满足任意一个条件的版本都会被保留，最新的版本总是被保留
+	// 开启多版本时不支持 B+ 树索引，打开时不使用 hint 文件，需要从所有的数据文件中加载保留的版本
+	RetainVersionAge time.Duration
 }
 
 // IteratorOptions 索引迭代器配置项
@@ -31,6 +86,8 @@ type IteratorOptions struct {
 	Prefix []byte
 	// 是否反向遍历，默认 false 是正向
 	Reverse bool
+	// 遍历序列号为 AsOfSeqNo 时的数据，默认 0 表示遍历最新的数据，只在开启多版本时生效
+	AsOfSeqNo uint64
 }
 
 // WriteBatchOptions 批量写配置项
@@ -42,6 +99,22 @@ type WriteBatchOptions struct {
 	SyncWrites bool
 }
 
+// WriteOptions 单次写操作的配置项
+type WriteOptions struct {
+	// 写入之后是否持久化，Options.SyncWrites 为 true 时总是持久化
+	// 持久化时之前所有没有持久化的数据也会一起持久化
+	Sync bool
+}
+
+// MergeOptions merge 配置项
+type MergeOptions struct {
+	// 进度回调，每处理完一个数据文件调用一次，默认为空
+	Progress func(info MergeProgressInfo)
+
+	// merge 读写数据的速率上限，单位为字节/秒，0 表示不限制
+	RateLimit int64
+}
+
 type IndexerType = int8
 
 const (
@@ -53,6 +126,12 @@ const (
 
 	// BPlusTree B+ 树索引，将索引存储到磁盘上
 	BPlusTree
+
+	// Hash 分片哈希表索引，点查更快，遍历时需要对所有的 key 排序
+	Hash
+
+	// SkipList 无锁的并发跳表索引，读操作不会阻塞
+	SkipList
 )
 
 var DefaultOptions = Options{
@@ -62,12 +141,33 @@ var DefaultOptions = Options{
 	BytesPerSync:       0,
 	IndexType:          BTree,
 	MMapAtStartup:      true,
+	IOType:             fio.StandardFIO,
 	DataFileMergeRatio: 0.5,
+	Metrics:            nopMetrics{},
+	EventListener:      NopEventListener{},
+	MinFreeDiskBytes:   0,
+	DiskCheckInterval:  10 * time.Second,
+	MaxKeySize:         0,
+	MaxValueSize:       0,
+	SyncInterval:       0,
+	PreallocateSize:    0,
+	FS:                 fio.OSFS{},
+	Comparator:         index.BytewiseComparator,
 }
 
 var DefaultIteratorOptions = IteratorOptions{
-	Prefix:  nil,
-	Reverse: false,
+	Prefix:    nil,
+	Reverse:   false,
+	AsOfSeqNo: 0,
+}
+
+var DefaultWriteOptions = WriteOptions{
+	Sync: false,
+}
+
+var DefaultMergeOptions = MergeOptions{
+	Progress:  nil,
+	RateLimit: 0,
 }
 
 var DefaultWriteBatchOptions = WriteBatchOptions{
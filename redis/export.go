@@ -0,0 +1,338 @@
+package redis
+
+import (
+	bitcask "bitcask-go"
+	"bitcask-go/utils"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+)
+
+// 导入时每个 WriteBatch 中的数据量
+const importBatchSize = 1000
+
+var ErrInvalidExportObject = errors.New("invalid redis export object")
+
+var dataTypeNames = map[redisDataType]string{
+	String: "string",
+	Hash:   "hash",
+	Set:    "set",
+	List:   "list",
+	ZSet:   "zset",
+}
+
+// ExportObject 导出的一个 Redis 数据结构，按照类型填充对应的字段，[]byte 类型在 JSON 中会被编码为 base64
+type ExportObject struct {
+	Type     string      `json:"type"`
+	Key      []byte      `json:"key"`
+	ExpireAt int64       `json:"expire_at,omitempty"` // 过期时间，UnixNano，0 表示不过期
+	Value    []byte      `json:"value,omitempty"`     // String
+	Fields   []HashField `json:"fields,omitempty"`    // Hash
+	Members  [][]byte    `json:"members,omitempty"`   // Set
+	Elements [][]byte    `json:"elements,omitempty"`  // List，从左到右
+	Entries  []ZSetEntry `json:"entries,omitempty"`   // ZSet
+}
+
+type HashField struct {
+	Field []byte `json:"field"`
+	Value []byte `json:"value"`
+}
+
+type ZSetEntry struct {
+	Member []byte  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// Export 将所有没有过期的数据结构以 JSONL 格式导出，每行一个 ExportObject，返回导出的数据量
+// 和 DB.Export 不同，这里导出的是完整的数据结构，而不是内部编码之后的 key
+func (rds *RedisDataStructure) Export(w io.Writer) (int, error) {
+	// 第一遍遍历，找到所有 Hash/Set/List/ZSet 数据部分的 key 前缀
+	prefixes, prefixLens, err := rds.internalKeyPrefixes()
+	if err != nil {
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	iter := rds.db.NewIterator(bitcask.DefaultIteratorOptions)
+	defer iter.Close()
+	// 用于读取数据部分的迭代器
+	elemIter := rds.db.NewIterator(bitcask.DefaultIteratorOptions)
+	defer elemIter.Close()
+
+	var count int
+	now := time.Now().UnixNano()
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		key := iter.Key()
+		if isInternalKey(key, prefixes, prefixLens) {
+			continue
+		}
+		value, err := iter.Value()
+		if err != nil {
+			if err == bitcask.ErrKeyNotFound {
+				continue
+			}
+			return count, err
+		}
+
+		obj, err := rds.exportObject(elemIter, key, value, now)
+		if err != nil {
+			return count, err
+		}
+		// 已经过期、为空或者无法识别的数据
+		if obj == nil {
+			continue
+		}
+		if err := enc.Encode(obj); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, bw.Flush()
+}
+
+// Import 读取 Export 导出的数据并写入，已经存在的 key 会被覆盖，返回导入的数据量
+func (rds *RedisDataStructure) Import(r io.Reader) (int, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var count int
+	now := time.Now().UnixNano()
+	for {
+		obj := &ExportObject{}
+		if err := dec.Decode(obj); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return count, err
+		}
+		if len(obj.Key) == 0 {
+			return count, ErrInvalidExportObject
+		}
+		// 导出之后已经过期的数据不再导入
+		if obj.ExpireAt != 0 && obj.ExpireAt <= now {
+			continue
+		}
+		if err := rds.importObject(obj); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rds.db.Sync()
+}
+
+// 找到所有数据部分 key 的前缀，即 key + version
+func (rds *RedisDataStructure) internalKeyPrefixes() (map[string]struct{}, map[int]struct{}, error) {
+	prefixes := make(map[string]struct{})
+	prefixLens := make(map[int]struct{})
+	iter := rds.db.NewIterator(bitcask.DefaultIteratorOptions)
+	defer iter.Close()
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			if err == bitcask.ErrKeyNotFound {
+				continue
+			}
+			return nil, nil, err
+		}
+		meta, ok := tryDecodeMetadata(value)
+		if !ok {
+			continue
+		}
+		prefix := internalKeyPrefix(iter.Key(), meta.version)
+		prefixes[string(prefix)] = struct{}{}
+		prefixLens[len(prefix)] = struct{}{}
+	}
+	return prefixes, prefixLens, nil
+}
+
+func isInternalKey(key []byte, prefixes map[string]struct{}, prefixLens map[int]struct{}) bool {
+	for l := range prefixLens {
+		if l > len(key) {
+			continue
+		}
+		if _, ok := prefixes[string(key[:l])]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func internalKeyPrefix(key []byte, version int64) []byte {
+	prefix := make([]byte, len(key)+8)
+	copy(prefix, key)
+	binary.LittleEndian.PutUint64(prefix[len(key):], uint64(version))
+	return prefix
+}
+
+// 解码元数据，并校验编码的长度，用于区分元数据和数据部分的 value
+func tryDecodeMetadata(buf []byte) (*metadata, bool) {
+	if len(buf) == 0 || buf[0] == String || buf[0] > ZSet {
+		return nil, false
+	}
+	var index = 1
+	for i := 0; i < 3; i++ {
+		_, n := binary.Varint(buf[index:])
+		if n <= 0 {
+			return nil, false
+		}
+		index += n
+	}
+	if buf[0] == List {
+		for i := 0; i < 2; i++ {
+			_, n := binary.Uvarint(buf[index:])
+			if n <= 0 {
+				return nil, false
+			}
+			index += n
+		}
+	}
+	if index != len(buf) {
+		return nil, false
+	}
+	return decodeMetadata(buf), true
+}
+
+func (rds *RedisDataStructure) exportObject(elemIter *bitcask.Iterator, key, value []byte, now int64) (*ExportObject, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	// String 类型 : type + expire + payload
+	if value[0] == String {
+		expire, n := binary.Varint(value[1:])
+		if n <= 0 || (expire > 0 && expire <= now) {
+			return nil, nil
+		}
+		return &ExportObject{Type: dataTypeNames[String], Key: key, ExpireAt: expire, Value: value[1+n:]}, nil
+	}
+
+	meta, ok := tryDecodeMetadata(value)
+	if !ok || meta.size == 0 || (meta.expire != 0 && meta.expire <= now) {
+		return nil, nil
+	}
+	obj := &ExportObject{Type: dataTypeNames[meta.dataType], Key: key, ExpireAt: meta.expire}
+
+	// List 按照下标读取，弹出的元素并不会被删除，不能直接遍历
+	if meta.dataType == List {
+		for index := meta.head; index < meta.tail; index++ {
+			lk := &listInternalKey{key: key, version: meta.version, index: index}
+			element, err := rds.db.Get(lk.encode())
+			if err != nil {
+				return nil, err
+			}
+			obj.Elements = append(obj.Elements, element)
+		}
+		return obj, nil
+	}
+
+	prefix := internalKeyPrefix(key, meta.version)
+	for elemIter.Seek(prefix); elemIter.Valid(); elemIter.Next() {
+		internalKey := elemIter.Key()
+		if !bytes.HasPrefix(internalKey, prefix) {
+			break
+		}
+		elemValue, err := elemIter.Value()
+		if err != nil {
+			if err == bitcask.ErrKeyNotFound {
+				continue
+			}
+			return nil, err
+		}
+		suffix := internalKey[len(prefix):]
+		switch meta.dataType {
+		case Hash:
+			obj.Fields = append(obj.Fields, HashField{Field: suffix, Value: elemValue})
+		case Set:
+			// member + member size
+			if len(suffix) < 4 {
+				continue
+			}
+			obj.Members = append(obj.Members, suffix[:len(suffix)-4])
+		case ZSet:
+			// 只处理 member -> score 的 key，score + member 的 key 的 value 为空
+			if len(elemValue) == 0 {
+				continue
+			}
+			obj.Entries = append(obj.Entries, ZSetEntry{Member: suffix, Score: utils.FloatFromBytes(elemValue)})
+		}
+	}
+	return obj, nil
+}
+
+func (rds *RedisDataStructure) importObject(obj *ExportObject) error {
+	if obj.Type == dataTypeNames[String] {
+		// 编码 value : type + expire + payload
+		buf := make([]byte, 1+binary.MaxVarintLen64+len(obj.Value))
+		buf[0] = String
+		var index = 1
+		index += binary.PutVarint(buf[index:], obj.ExpireAt)
+		index += copy(buf[index:], obj.Value)
+		return rds.db.Put(obj.Key, buf[:index])
+	}
+
+	// 使用新的版本号，覆盖掉已经存在的数据
+	meta := &metadata{expire: obj.ExpireAt, version: time.Now().UnixNano()}
+	var kvs [][2][]byte
+	switch obj.Type {
+	case dataTypeNames[Hash]:
+		meta.dataType = Hash
+		for _, f := range obj.Fields {
+			hk := &hashInternalKey{key: obj.Key, version: meta.version, field: f.Field}
+			kvs = append(kvs, [2][]byte{hk.encode(), f.Value})
+		}
+	case dataTypeNames[Set]:
+		meta.dataType = Set
+		for _, member := range obj.Members {
+			sk := &setInternalKey{key: obj.Key, version: meta.version, member: member}
+			kvs = append(kvs, [2][]byte{sk.encode(), nil})
+		}
+	case dataTypeNames[List]:
+		meta.dataType = List
+		meta.head = initialListMark
+		meta.tail = initialListMark
+		for _, element := range obj.Elements {
+			lk := &listInternalKey{key: obj.Key, version: meta.version, index: meta.tail}
+			kvs = append(kvs, [2][]byte{lk.encode(), element})
+			meta.tail++
+		}
+	case dataTypeNames[ZSet]:
+		meta.dataType = ZSet
+		for _, entry := range obj.Entries {
+			zk := &zsetInternalKey{key: obj.Key, version: meta.version, member: entry.Member, score: entry.Score}
+			kvs = append(kvs, [2][]byte{zk.encodeWithMember(), utils.Float64ToBytes(entry.Score)})
+			kvs = append(kvs, [2][]byte{zk.encodeWithScore(), nil})
+		}
+	default:
+		return ErrInvalidExportObject
+	}
+	if len(kvs) == 0 {
+		return nil
+	}
+	if meta.dataType == ZSet {
+		meta.size = uint32(len(kvs) / 2)
+	} else {
+		meta.size = uint32(len(kvs))
+	}
+
+	// 数据部分分批写入，元数据在最后一批中写入，导入失败时已经写入的数据部分不可见
+	opts := bitcask.DefaultWriteBatchOptions
+	opts.SyncWrites = false
+	wb := rds.db.NewWriteBatch(opts)
+	for i, kv := range kvs {
+		if err := wb.Put(kv[0], kv[1]); err != nil {
+			return err
+		}
+		if (i+1)%importBatchSize == 0 {
+			if err := wb.Commit(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := wb.Put(obj.Key, meta.encode()); err != nil {
+		return err
+	}
+	return wb.Commit()
+}
@@ -0,0 +1,101 @@
+package redis
+
+import (
+	bitcask "bitcask-go"
+	"bitcask-go/utils"
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRedisDataStructure_ExportImport(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-export")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer rds.Close()
+
+	err = rds.Set([]byte("str"), time.Hour, []byte("val"))
+	assert.Nil(t, err)
+	err = rds.Set([]byte("expired"), time.Nanosecond, []byte("val"))
+	assert.Nil(t, err)
+	_, err = rds.HSet([]byte("hash"), []byte("field1"), []byte("value1"))
+	assert.Nil(t, err)
+	_, err = rds.HSet([]byte("hash"), []byte("field2"), []byte("value2"))
+	assert.Nil(t, err)
+	_, err = rds.SAdd([]byte("set"), []byte("member1"))
+	assert.Nil(t, err)
+	_, err = rds.SAdd([]byte("set"), []byte("member2"))
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = rds.RPush([]byte("list"), utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	_, err = rds.LPop([]byte("list"))
+	assert.Nil(t, err)
+	_, err = rds.ZAdd([]byte("zset"), 10, []byte("member1"))
+	assert.Nil(t, err)
+	_, err = rds.ZAdd([]byte("zset"), 1.5, []byte("member2"))
+	assert.Nil(t, err)
+	_, err = rds.ZAdd([]byte("zset"), 20, []byte("member1"))
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	n, err := rds.Export(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+
+	objects := make(map[string]*ExportObject)
+	dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for dec.More() {
+		obj := &ExportObject{}
+		assert.Nil(t, dec.Decode(obj))
+		objects[string(obj.Key)] = obj
+	}
+	assert.Equal(t, "string", objects["str"].Type)
+	assert.NotEqual(t, int64(0), objects["str"].ExpireAt)
+	assert.Equal(t, []HashField{{[]byte("field1"), []byte("value1")}, {[]byte("field2"), []byte("value2")}}, objects["hash"].Fields)
+	assert.Equal(t, [][]byte{[]byte("member1"), []byte("member2")}, objects["set"].Members)
+	assert.Equal(t, [][]byte{utils.GetTestKey(1), utils.GetTestKey(2)}, objects["list"].Elements)
+	assert.ElementsMatch(t, []ZSetEntry{{[]byte("member1"), 20}, {[]byte("member2"), 1.5}}, objects["zset"].Entries)
+
+	// 导入到新的实例中
+	opts2 := bitcask.DefaultOptions
+	dir2, _ := os.MkdirTemp("", "bitcask-go-redis-import")
+	defer os.RemoveAll(dir2)
+	opts2.DirPath = dir2
+	rds2, err := NewRedisDataStructure(opts2)
+	assert.Nil(t, err)
+	defer rds2.Close()
+
+	n, err = rds2.Import(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+
+	val, err := rds2.Get([]byte("str"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("val"), val)
+	val, err = rds2.HGet([]byte("hash"), []byte("field2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value2"), val)
+	ok, err := rds2.SIsMember([]byte("set"), []byte("member1"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	val, err = rds2.LPop([]byte("list"))
+	assert.Nil(t, err)
+	assert.Equal(t, utils.GetTestKey(1), val)
+	score, err := rds2.ZScore([]byte("zset"), []byte("member1"))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(20), score)
+
+	// 再次导出的结果和原实例相同
+	var buf2 bytes.Buffer
+	n, err = rds2.Export(&buf2)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+}
@@ -115,9 +115,13 @@ func (rds *RedisDataStructure) HSet(key, field, value []byte) (bool, error) {
 	// 不存在则更新元数据
 	if !exist {
 		meta.size++
-		_ = wb.Put(key, meta.encode())
+		if err = wb.Put(key, meta.encode()); err != nil {
+			return false, err
+		}
+	}
+	if err = wb.Put(encKey, value); err != nil {
+		return false, err
 	}
-	_ = wb.Put(encKey, value)
 	if err = wb.Commit(); err != nil {
 		return false, err
 	}
@@ -167,8 +171,12 @@ func (rds *RedisDataStructure) HDel(key, field []byte) (bool, error) {
 	if exist {
 		wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
 		meta.size--
-		_ = wb.Put(key, meta.encode())
-		_ = wb.Delete(encKey)
+		if err = wb.Put(key, meta.encode()); err != nil {
+			return false, err
+		}
+		if err = wb.Delete(encKey); err != nil {
+			return false, err
+		}
 		if err = wb.Commit(); err != nil {
 			return false, err
 		}
@@ -198,8 +206,12 @@ func (rds *RedisDataStructure) SAdd(key, member []byte) (bool, error) {
 		// 不存在的话则更新
 		wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
 		meta.size++
-		_ = wb.Put(key, meta.encode())
-		_ = wb.Put(sk.encode(), nil)
+		if err = wb.Put(key, meta.encode()); err != nil {
+			return false, err
+		}
+		if err = wb.Put(sk.encode(), nil); err != nil {
+			return false, err
+		}
 		if err = wb.Commit(); err != nil {
 			return false, err
 		}
@@ -258,8 +270,12 @@ func (rds *RedisDataStructure) SRem(key, member []byte) (bool, error) {
 	// 更新
 	wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
 	meta.size--
-	_ = wb.Put(key, meta.encode())
-	_ = wb.Delete(sk.encode())
+	if err = wb.Put(key, meta.encode()); err != nil {
+		return false, err
+	}
+	if err = wb.Delete(sk.encode()); err != nil {
+		return false, err
+	}
 	if err = wb.Commit(); err != nil {
 		return false, err
 	}
@@ -310,8 +326,12 @@ func (rds *RedisDataStructure) pushInner(key, element []byte, isLeft bool) (uint
 	} else {
 		meta.tail++
 	}
-	_ = wb.Put(key, meta.encode())
-	_ = wb.Put(lk.encode(), element)
+	if err = wb.Put(key, meta.encode()); err != nil {
+		return 0, err
+	}
+	if err = wb.Put(lk.encode(), element); err != nil {
+		return 0, err
+	}
 	if err = wb.Commit(); err != nil {
 		return 0, err
 	}
@@ -394,7 +414,9 @@ func (rds *RedisDataStructure) ZAdd(key []byte, score float64, member []byte) (b
 	wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
 	if !exist {
 		meta.size++
-		_ = wb.Put(key, meta.encode())
+		if err = wb.Put(key, meta.encode()); err != nil {
+			return false, err
+		}
 	}
 	if exist {
 		oldKey := &zsetInternalKey{
@@ -403,10 +425,16 @@ func (rds *RedisDataStructure) ZAdd(key []byte, score float64, member []byte) (b
 			member:  member,
 			score:   utils.FloatFromBytes(value),
 		}
-		_ = wb.Delete(oldKey.encodeWithScore())
+		if err = wb.Delete(oldKey.encodeWithScore()); err != nil {
+			return false, err
+		}
+	}
+	if err = wb.Put(zk.encodeWithMember(), utils.Float64ToBytes(score)); err != nil {
+		return false, err
+	}
+	if err = wb.Put(zk.encodeWithScore(), nil); err != nil {
+		return false, err
 	}
-	_ = wb.Put(zk.encodeWithMember(), utils.Float64ToBytes(score))
-	_ = wb.Put(zk.encodeWithScore(), nil)
 	if err = wb.Commit(); err != nil {
 		return false, err
 	}
@@ -92,6 +92,35 @@ func TestRedisDataStructure_HGet(t *testing.T) {
 	assert.Equal(t, bitcask.ErrKeyNotFound, err)
 }
 
+func TestRedisDataStructure_SizeLimit(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-size-limit")
+	opts.DirPath = dir
+	opts.MaxKeySize = 64
+	opts.MaxValueSize = 128
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+
+	err = rds.Set(utils.GetTestKey(1), 0, utils.RandomValue(200))
+	assert.Equal(t, bitcask.ErrValueTooLarge, err)
+	_, err = rds.HSet(utils.GetTestKey(1), []byte("field1"), utils.RandomValue(200))
+	assert.Equal(t, bitcask.ErrValueTooLarge, err)
+	// 数据部分的 key 由 key + version + field 组成
+	_, err = rds.HSet(utils.GetTestKey(1), make([]byte, 64), utils.RandomValue(10))
+	assert.Equal(t, bitcask.ErrKeyTooLarge, err)
+	_, err = rds.SAdd(utils.GetTestKey(1), make([]byte, 64))
+	assert.Equal(t, bitcask.ErrKeyTooLarge, err)
+	_, err = rds.RPush(utils.GetTestKey(1), utils.RandomValue(200))
+	assert.Equal(t, bitcask.ErrValueTooLarge, err)
+	_, err = rds.ZAdd(utils.GetTestKey(1), 1, make([]byte, 64))
+	assert.Equal(t, bitcask.ErrKeyTooLarge, err)
+
+	// 写入失败时元数据没有被更新
+	typ, err := rds.Type(utils.GetTestKey(1))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+	assert.Equal(t, byte(0), typ)
+}
+
 func TestRedisDataStructure_HDel(t *testing.T) {
 	opts := bitcask.DefaultOptions
 	dir, _ := os.MkdirTemp("", "bitcask-go-redis-hdel")
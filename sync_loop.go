@@ -0,0 +1,24 @@
+package bitcask_go
+
+import "time"
+
+// 后台定期持久化活跃文件，保证掉电时丢失的数据不会超过 SyncInterval 时间内写入的数据
+func (db *DB) syncLoop() {
+	defer db.bgWg.Done()
+	ticker := time.NewTicker(db.options.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-db.closeCh:
+			return
+		case <-ticker.C:
+			// 持有锁保证不会和写入、切换活跃文件同时进行
+			db.mu.Lock()
+			if db.activeFile != nil && db.bytesWrite > 0 {
+				// 失败时已经通过 OnSyncError 通知，下一次继续重试
+				_ = db.syncActiveFile()
+			}
+			db.mu.Unlock()
+		}
+	}
+}
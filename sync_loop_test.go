@@ -0,0 +1,55 @@
+package bitcask_go
+
+import (
+	"bitcask-go/utils"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDB_SyncInterval(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-sync-interval")
+	opts.DirPath = dir
+	opts.SyncInterval = 10 * time.Millisecond
+	metrics := newTestMetrics()
+	opts.Metrics = metrics
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.True(t, db.Stat().LastSyncTime.IsZero())
+
+	fsyncTotal := func() uint64 {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		return metrics.counters[MetricFsyncTotal]
+	}
+
+	// 没有写入时不会持久化
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, uint64(0), fsyncTotal())
+
+	start := time.Now()
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(24))
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		return fsyncTotal() == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.True(t, db.Stat().LastSyncTime.After(start))
+
+	// 写入的数据已经全部持久化，不会重复持久化
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, uint64(1), fsyncTotal())
+
+	// 关闭时持久化一次，之后后台任务退出
+	assert.Nil(t, db.Close())
+	db.activeFile = nil
+	assert.Equal(t, uint64(2), fsyncTotal())
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, uint64(2), fsyncTotal())
+
+	opts.SyncInterval = -1
+	_, err = Open(opts)
+	assert.NotNil(t, err)
+}
@@ -1,74 +1,23 @@
 package utils
 
 import (
-	"io/fs"
-	"os"
-	"path/filepath"
-	"strings"
 	"syscall"
 )
 
-// DirSize 获取一个目录的大小
-func DirSize(dirPath string) (int64, error) {
-	var size int64
-	err := filepath.Walk(dirPath, func(path string, info fs.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			size += info.Size()
-		}
-		return nil
-	})
-	return size, err
-}
-
 // AvailableDiskSize 获取磁盘剩余可用空间大小
 func AvailableDiskSize() (uint64, error) {
 	wd, err := syscall.Getwd()
 	if err != nil {
 		return 0, err
 	}
+	return AvailableDiskSizeOf(wd)
+}
+
+// AvailableDiskSizeOf 获取指定目录所在磁盘的剩余可用空间大小
+func AvailableDiskSizeOf(dirPath string) (uint64, error) {
 	var stat syscall.Statfs_t
-	if err = syscall.Statfs(wd, &stat); err != nil {
+	if err := syscall.Statfs(dirPath, &stat); err != nil {
 		return 0, err
 	}
 	return stat.Bavail * uint64(stat.Bsize), nil
 }
-
-// CopyDir 拷贝数据目录
-func CopyDir(src, dest string, exclude []string) error {
-	// 目标目标不存在则创建
-	if _, err := os.Stat(dest); os.IsNotExist(err) {
-		if err := os.MkdirAll(dest, os.ModePerm); err != nil {
-			return err
-		}
-	}
-
-	return filepath.Walk(src, func(path string, info fs.FileInfo, err error) error {
-		fileName := strings.Replace(path, src, "", 1)
-		if fileName == "" {
-			return nil
-		}
-
-		for _, e := range exclude {
-			matched, err := filepath.Match(e, info.Name())
-			if err != nil {
-				return err
-			}
-			if matched {
-				return nil
-			}
-		}
-
-		if info.IsDir() {
-			return os.MkdirAll(filepath.Join(dest, fileName), info.Mode())
-		}
-
-		data, err := os.ReadFile(filepath.Join(src, fileName))
-		if err != nil {
-			return err
-		}
-		return os.WriteFile(filepath.Join(dest, fileName), data, info.Mode())
-	})
-}
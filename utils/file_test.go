@@ -6,15 +6,17 @@ import (
 	"testing"
 )
 
-func TestDirSize(t *testing.T) {
-	dir, _ := os.Getwd()
-	dirSize, err := DirSize(dir)
+func TestAvailableDiskSize(t *testing.T) {
+	size, err := AvailableDiskSize()
 	assert.Nil(t, err)
-	assert.True(t, dirSize > 0)
+	assert.True(t, size > 0)
 }
 
-func TestAvailableDiskSize(t *testing.T) {
-	size, err := AvailableDiskSize()
+func TestAvailableDiskSizeOf(t *testing.T) {
+	size, err := AvailableDiskSizeOf(os.TempDir())
 	assert.Nil(t, err)
 	assert.True(t, size > 0)
+
+	_, err = AvailableDiskSizeOf("/some/dir/not/exist")
+	assert.NotNil(t, err)
 }
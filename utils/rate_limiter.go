@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// RateLimiter 按字节数限制读写速率的限速器
+type RateLimiter struct {
+	rate  int64     // 每秒允许的字节数，小于等于 0 表示不限制
+	start time.Time // 开始计算速率的时间
+	bytes int64     // 累计消耗的字节数
+}
+
+// NewRateLimiter 初始化限速器
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	return &RateLimiter{rate: bytesPerSec, start: time.Now()}
+}
+
+// Wait 消耗 n 个字节的配额，如果超过了速率则阻塞等待，等待过程中可以被 ctx 取消
+func (rl *RateLimiter) Wait(ctx context.Context, n int64) error {
+	if rl.rate <= 0 {
+		return nil
+	}
+	rl.bytes += n
+	expected := time.Duration(float64(rl.bytes) / float64(rl.rate) * float64(time.Second))
+	wait := expected - time.Since(rl.start)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	// 不限速
+	rl1 := NewRateLimiter(0)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, rl1.Wait(context.Background(), 1024*1024))
+	}
+	assert.True(t, time.Since(now) < 100*time.Millisecond)
+
+	// 限速 1MB/s，写 200KB 大约需要 200ms
+	rl2 := NewRateLimiter(1024 * 1024)
+	now = time.Now()
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, rl2.Wait(context.Background(), 1024))
+	}
+	assert.True(t, time.Since(now) >= 150*time.Millisecond)
+
+	// 等待的过程中被取消
+	rl3 := NewRateLimiter(1024)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := rl3.Wait(ctx, 1024*1024)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
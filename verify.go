@@ -0,0 +1,503 @@
+package bitcask_go
+
+import (
+	"bitcask-go/data"
+	"bitcask-go/fio"
+	"bitcask-go/index"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errIncompleteRecord = errors.New("log record is incomplete or its size is corrupted")
+
+// CorruptRecord 校验失败的记录
+type CorruptRecord struct {
+	FileId uint32 // 所在的数据文件 id
+	Offset int64  // 在数据文件中的偏移
+	Err    error  // 失败的原因
+}
+
+// UncommittedTxn 没有完成标识的事务，这些数据在打开数据库时会被丢弃
+type UncommittedTxn struct {
+	SeqNo   uint64 // 事务序列号
+	Records int    // 事务中的记录数量
+	FileId  uint32 // 第一条记录所在的数据文件 id
+	Offset  int64  // 第一条记录在数据文件中的偏移
+}
+
+// InvalidHint 无效的 hint 索引
+type InvalidHint struct {
+	Key    []byte
+	Pos    *data.LogRecordPos
+	Reason string
+}
+
+// MergeDirInfo 遗留的 merge 目录
+type MergeDirInfo struct {
+	Path     string   // merge 目录的路径
+	Finished bool     // merge 是否已经完成，完成的 merge 会在下次打开数据库时加载，否则会被丢弃
+	Files    []string // 目录中的文件
+}
+
+// VerifyReport 数据目录的校验结果
+type VerifyReport struct {
+	DirPath         string
+	DataFiles       []uint32         // 数据文件 id
+	Records         int              // 有效的记录数量
+	Bytes           int64            // 有效的记录占用的空间
+	CorruptRecords  []CorruptRecord  // 校验失败的记录
+	UncommittedTxns []UncommittedTxn // 没有完成标识的事务
+	HintRecords     int              // hint 文件中的索引数量
+	InvalidHints    []InvalidHint    // 无效的 hint 索引
+	SeqNoFileExists bool             // seq-no 文件是否存在
+	SeqNo           uint64           // seq-no 文件中保存的事务序列号
+	SeqNoErr        error            // seq-no 文件无法读取的原因
+	MaxSeqNo        uint64           // 数据文件中出现过的最大事务序列号
+	MergeDir        *MergeDirInfo    // 遗留的 merge 目录，没有则为 nil
+}
+
+// Healthy 数据目录中没有损坏的数据
+// 没有完成的事务和遗留的 merge 目录在打开数据库时会被正常处理，不影响结果
+func (r *VerifyReport) Healthy() bool {
+	return len(r.CorruptRecords) == 0 && len(r.InvalidHints) == 0 && r.SeqNoErr == nil
+}
+
+// RepairReport 修复的结果
+type RepairReport struct {
+	Records        int // 写入到新目录中的记录数量
+	CorruptRecords int // 跳过的损坏记录数量
+	DroppedRecords int // 丢弃的未完成事务中的记录数量
+	Keys           int // 新目录中的 key 数量
+}
+
+// Verify 校验数据目录中的所有文件，不会加锁，也不会写入任何数据
+// 可以用于离线检查，也可以检查正在被其他进程使用的目录
+func Verify(dirPath string) (*VerifyReport, error) {
+	return VerifyWithFS(fio.OSFS{}, dirPath)
+}
+
+// VerifyWithFS 校验指定文件系统中的数据目录
+func VerifyWithFS(fs fio.VFS, dirPath string) (*VerifyReport, error) {
+	dataFiles, err := openDataFilesForVerify(fs, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDataFiles(dataFiles)
+
+	report := &VerifyReport{DirPath: dirPath}
+	type txnState struct {
+		first   *data.LogRecordPos
+		records int
+	}
+	transactions := make(map[uint64]*txnState)
+	for _, dataFile := range dataFiles {
+		report.DataFiles = append(report.DataFiles, dataFile.FileId)
+		err := scanDataFile(dataFile, func(record *data.LogRecord, offset, size int64) {
+			report.Records++
+			report.Bytes += size
+			_, seqNo := parseLogRecordKey(record.Key)
+			if seqNo == nonTransactionSeqNo {
+				return
+			}
+			if seqNo > report.MaxSeqNo {
+				report.MaxSeqNo = seqNo
+			}
+			if record.Type == data.LogRecordTxnFinished {
+				delete(transactions, seqNo)
+				return
+			}
+			txn, ok := transactions[seqNo]
+			if !ok {
+				txn = &txnState{first: &data.LogRecordPos{Fid: dataFile.FileId, Offset: offset}}
+				transactions[seqNo] = txn
+			}
+			txn.records++
+		}, func(offset int64, err error) {
+			report.CorruptRecords = append(report.CorruptRecords, CorruptRecord{
+				FileId: dataFile.FileId,
+				Offset: offset,
+				Err:    err,
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for seqNo, txn := range transactions {
+		report.UncommittedTxns = append(report.UncommittedTxns, UncommittedTxn{
+			SeqNo:   seqNo,
+			Records: txn.records,
+			FileId:  txn.first.Fid,
+			Offset:  txn.first.Offset,
+		})
+	}
+	sort.Slice(report.UncommittedTxns, func(i, j int) bool {
+		return report.UncommittedTxns[i].SeqNo < report.UncommittedTxns[j].SeqNo
+	})
+
+	if err := verifyHintFile(fs, dirPath, dataFiles, report); err != nil {
+		return nil, err
+	}
+	if err := verifySeqNoFile(fs, dirPath, report); err != nil {
+		return nil, err
+	}
+	if err := verifyMergeDir(fs, dirPath, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Repair 将数据目录中所有可以恢复的数据写入到一个新的目录中，原目录不会被修改
+// 损坏的记录和没有完成的事务会被丢弃，已经提交的事务会作为普通数据写入
+func Repair(dirPath, destPath string) (*RepairReport, error) {
+	return RepairWithFS(fio.OSFS{}, dirPath, destPath)
+}
+
+// RepairWithFS 修复指定文件系统中的数据目录，新的目录在同一个文件系统中
+func RepairWithFS(fs fio.VFS, dirPath, destPath string) (*RepairReport, error) {
+	opts := DefaultOptions
+	opts.DirPath = destPath
+	opts.FS = fs
+	return RepairWithOptions(dirPath, opts)
+}
+
+// RepairWithOptions 按照 opts 打开新的目录并写入修复的数据，opts.DirPath 是新的目录，原目录在 opts.FS 中
+// 使用自定义比较器的数据库需要传入相同的比较器，否则返回 ErrComparatorMismatch
+func RepairWithOptions(dirPath string, opts Options) (*RepairReport, error) {
+	fs, destPath := opts.FS, opts.DirPath
+	if fs == nil {
+		fs = fio.OSFS{}
+	}
+	if entries, err := fs.ReadDir(destPath); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("repair destination %s is not empty", destPath)
+	}
+	if err := checkRepairComparator(fs, dirPath, opts.Comparator); err != nil {
+		return nil, err
+	}
+	dataFiles, err := openDataFilesForVerify(fs, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	defer closeDataFiles(dataFiles)
+
+	opts.MMapAtStartup = false
+	destDB, err := Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RepairReport{}
+	apply := func(key []byte, record *data.LogRecord) error {
+		var err error
+		switch record.Type {
+		case data.LogRecordNormal:
+			err = destDB.Put(key, record.Value)
+		case data.LogRecordVersioned:
+			// 修复之后的数据库重新分配序列号和写入时间
+			_, _, value := data.DecodeVersionedValue(record.Value)
+			err = destDB.Put(key, value)
+		case data.LogRecordDeleted, data.LogRecordVersionDeleted:
+			err = destDB.Delete(key)
+		}
+		if err == nil {
+			report.Records++
+		}
+		return err
+	}
+
+	transactions := make(map[uint64][]*data.LogRecord)
+	for _, dataFile := range dataFiles {
+		var applyErr error
+		err := scanDataFile(dataFile, func(record *data.LogRecord, offset, size int64) {
+			if applyErr != nil {
+				return
+			}
+			realKey, seqNo := parseLogRecordKey(record.Key)
+			if seqNo == nonTransactionSeqNo {
+				applyErr = apply(realKey, record)
+				return
+			}
+			if record.Type == data.LogRecordTxnFinished {
+				for _, txnRecord := range transactions[seqNo] {
+					if applyErr = apply(txnRecord.Key, txnRecord); applyErr != nil {
+						return
+					}
+				}
+				delete(transactions, seqNo)
+				return
+			}
+			record.Key = realKey
+			transactions[seqNo] = append(transactions[seqNo], record)
+		}, func(offset int64, err error) {
+			report.CorruptRecords++
+		})
+		if err == nil {
+			err = applyErr
+		}
+		if err != nil {
+			_ = destDB.Close()
+			return nil, err
+		}
+	}
+	for _, records := range transactions {
+		report.DroppedRecords += len(records)
+	}
+
+	report.Keys = destDB.index.Size()
+	if err := destDB.Sync(); err != nil {
+		_ = destDB.Close()
+		return nil, err
+	}
+	return report, destDB.Close()
+}
+
+// 原目录的 options 文件中记录的比较器需要和修复时使用的比较器相同
+func checkRepairComparator(fs fio.VFS, dirPath string, comparator index.Comparator) error {
+	name := index.BytewiseComparator.Name()
+	if comparator != nil {
+		name = comparator.Name()
+	}
+	if _, err := fs.Stat(filepath.Join(dirPath, data.OptionsFileName)); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	stored, err := readComparatorName(fs, dirPath)
+	if err != nil {
+		return err
+	}
+	if stored != name {
+		return fmt.Errorf("%w: %s, the database uses %s", ErrComparatorMismatch, name, stored)
+	}
+	return nil
+}
+
+// 打开目录中所有的数据文件并按照文件 id 排序，只用于读取
+func openDataFilesForVerify(fs fio.VFS, dirPath string) ([]*data.DataFile, error) {
+	entries, err := fs.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	var fileIds []int
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), data.DataFileNameSuffix) {
+			continue
+		}
+		fileId, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), data.DataFileNameSuffix))
+		if err != nil {
+			return nil, ErrDataDirectoryCorrupted
+		}
+		fileIds = append(fileIds, fileId)
+	}
+	sort.Ints(fileIds)
+
+	var dataFiles []*data.DataFile
+	for _, fid := range fileIds {
+		dataFile, err := data.OpenDataFile(fs, dirPath, uint32(fid), fio.StandardFIO)
+		if err != nil {
+			closeDataFiles(dataFiles)
+			return nil, err
+		}
+		dataFiles = append(dataFiles, dataFile)
+	}
+	return dataFiles, nil
+}
+
+func closeDataFiles(dataFiles []*data.DataFile) {
+	for _, dataFile := range dataFiles {
+		_ = dataFile.Close()
+	}
+}
+
+// 顺序扫描数据文件中的所有记录
+// 遇到损坏的记录时调用 onCorrupt，并逐字节向后查找下一条有效的记录，尽可能多地读取数据
+func scanDataFile(dataFile *data.DataFile,
+	onRecord func(record *data.LogRecord, offset, size int64),
+	onCorrupt func(offset int64, err error)) error {
+	fileSize, err := dataFile.IoManager.Size()
+	if err != nil {
+		return err
+	}
+
+	var offset int64 = 0
+	for offset < fileSize {
+		logRecord, size, err := dataFile.ReadLogRecord(offset)
+		if err == nil {
+			onRecord(logRecord, offset, size)
+			offset += size
+			continue
+		}
+		if err != io.EOF && err != data.ErrInvalidCRC {
+			return err
+		}
+		if err == io.EOF {
+			// 剩余的部分全部是 0，说明是正常的文件末尾
+			zero, zeroErr := isZeroRange(dataFile, offset, fileSize)
+			if zeroErr != nil {
+				return zeroErr
+			}
+			if zero {
+				return nil
+			}
+			err = errIncompleteRecord
+		}
+		onCorrupt(offset, err)
+
+		if offset, err = findNextRecord(dataFile, offset+1, fileSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 从 offset 开始逐字节查找下一条能够通过校验的记录，找不到则返回文件大小
+func findNextRecord(dataFile *data.DataFile, offset, fileSize int64) (int64, error) {
+	for ; offset < fileSize; offset++ {
+		_, _, err := dataFile.ReadLogRecord(offset)
+		if err == nil {
+			return offset, nil
+		}
+		if err != io.EOF && err != data.ErrInvalidCRC {
+			return 0, err
+		}
+	}
+	return fileSize, nil
+}
+
+// 判断数据文件中 [start, end) 范围内的数据是否全部为 0
+func isZeroRange(dataFile *data.DataFile, start, end int64) (bool, error) {
+	buf := make([]byte, 64*1024)
+	for start < end {
+		n := int64(len(buf))
+		if end-start < n {
+			n = end - start
+		}
+		if _, err := dataFile.IoManager.Read(buf[:n], start); err != nil && err != io.EOF {
+			return false, err
+		}
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false, nil
+			}
+		}
+		start += n
+	}
+	return true, nil
+}
+
+// 校验 hint 文件中的索引是否指向有效的记录
+func verifyHintFile(fs fio.VFS, dirPath string, dataFiles []*data.DataFile, report *VerifyReport) error {
+	if _, err := fs.Stat(filepath.Join(dirPath, data.HintFileName)); os.IsNotExist(err) {
+		return nil
+	}
+	hintFile, err := data.OpenHintFile(fs, dirPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = hintFile.Close()
+	}()
+
+	files := make(map[uint32]*data.DataFile)
+	for _, dataFile := range dataFiles {
+		files[dataFile.FileId] = dataFile
+	}
+	checkHint := func(key []byte, pos *data.LogRecordPos) (string, error) {
+		dataFile, ok := files[pos.Fid]
+		if !ok {
+			return "data file not found", nil
+		}
+		fileSize, err := dataFile.IoManager.Size()
+		if err != nil {
+			return "", err
+		}
+		if pos.Offset+int64(pos.Size) > fileSize {
+			return fmt.Sprintf("points past the end of the data file (size %d)", fileSize), nil
+		}
+		logRecord, _, err := dataFile.ReadLogRecord(pos.Offset)
+		if err != nil {
+			if err == io.EOF || err == data.ErrInvalidCRC {
+				return fmt.Sprintf("points to an invalid record: %v", err), nil
+			}
+			return "", err
+		}
+		if realKey, _ := parseLogRecordKey(logRecord.Key); !bytes.Equal(realKey, key) {
+			return "points to a record of another key", nil
+		}
+		return "", nil
+	}
+
+	return scanDataFile(hintFile, func(record *data.LogRecord, offset, size int64) {
+		report.HintRecords++
+		pos := data.DecodeLogRecordPos(record.Value)
+		reason, err := checkHint(record.Key, pos)
+		if err != nil {
+			reason = err.Error()
+		}
+		if reason != "" {
+			report.InvalidHints = append(report.InvalidHints, InvalidHint{Key: record.Key, Pos: pos, Reason: reason})
+		}
+	}, func(offset int64, err error) {
+		report.CorruptRecords = append(report.CorruptRecords, CorruptRecord{Offset: offset, Err: fmt.Errorf("hint file: %w", err)})
+	})
+}
+
+// 校验 seq-no 文件
+func verifySeqNoFile(fs fio.VFS, dirPath string, report *VerifyReport) error {
+	if _, err := fs.Stat(filepath.Join(dirPath, data.SeqNoFileName)); os.IsNotExist(err) {
+		return nil
+	}
+	report.SeqNoFileExists = true
+	seqNoFile, err := data.OpenSeqNoFile(fs, dirPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = seqNoFile.Close()
+	}()
+
+	record, _, err := seqNoFile.ReadLogRecord(0)
+	if err != nil {
+		report.SeqNoErr = err
+		return nil
+	}
+	seqNo, err := strconv.ParseUint(string(record.Value), 10, 64)
+	if err != nil {
+		report.SeqNoErr = err
+		return nil
+	}
+	report.SeqNo = seqNo
+	if seqNo < report.MaxSeqNo {
+		report.SeqNoErr = fmt.Errorf("seq no %d is smaller than the max seq no %d in data files", seqNo, report.MaxSeqNo)
+	}
+	return nil
+}
+
+// 检查是否有遗留的 merge 目录
+func verifyMergeDir(fs fio.VFS, dirPath string, report *VerifyReport) error {
+	mergePath := getMergePath(dirPath)
+	entries, err := fs.ReadDir(mergePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info := &MergeDirInfo{Path: mergePath}
+	for _, entry := range entries {
+		if entry.Name() == data.MergeFinishedFileName {
+			info.Finished = true
+		}
+		info.Files = append(info.Files, entry.Name())
+	}
+	report.MergeDir = info
+	return nil
+}
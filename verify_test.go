@@ -0,0 +1,236 @@
+package bitcask_go
+
+import (
+	"bitcask-go/data"
+	"bitcask-go/fio"
+	"bitcask-go/utils"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 写入测试数据之后关闭数据库，返回数据目录
+func prepareVerifyDir(t *testing.T, name string, n int) string {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", name)
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < n; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(100))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.Close())
+	return dir
+}
+
+func TestVerify(t *testing.T) {
+	dir := prepareVerifyDir(t, "bitcask-go-verify", 100)
+	defer os.RemoveAll(dir)
+
+	report, err := Verify(dir)
+	assert.Nil(t, err)
+	assert.True(t, report.Healthy())
+	assert.Equal(t, []uint32{0}, report.DataFiles)
+	assert.Equal(t, 100, report.Records)
+	assert.True(t, report.SeqNoFileExists)
+	assert.Nil(t, report.MergeDir)
+}
+
+func TestVerify_CorruptRecord(t *testing.T) {
+	dir := prepareVerifyDir(t, "bitcask-go-verify-corrupt", 100)
+	defer os.RemoveAll(dir)
+
+	// 修改第 11 条记录中 value 的一个字节
+	fileName := data.GetDataFileName(dir, 0)
+	buf, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	recordSize := int64(len(buf) / 100)
+	buf[recordSize*10+recordSize-1] ^= 0xff
+	assert.Nil(t, os.WriteFile(fileName, buf, fio.DataFilePerm))
+
+	report, err := Verify(dir)
+	assert.Nil(t, err)
+	assert.False(t, report.Healthy())
+	assert.Equal(t, 99, report.Records)
+	assert.Equal(t, 1, len(report.CorruptRecords))
+	assert.Equal(t, recordSize*10, report.CorruptRecords[0].Offset)
+	assert.Equal(t, data.ErrInvalidCRC, report.CorruptRecords[0].Err)
+
+	// 修复到新的目录中，跳过损坏的记录
+	destDir, _ := os.MkdirTemp("", "bitcask-go-verify-repair")
+	defer os.RemoveAll(destDir)
+	repairReport, err := Repair(dir, destDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 99, repairReport.Records)
+	assert.Equal(t, 1, repairReport.CorruptRecords)
+	assert.Equal(t, 99, repairReport.Keys)
+
+	report, err = Verify(destDir)
+	assert.Nil(t, err)
+	assert.True(t, report.Healthy())
+
+	opts := DefaultOptions
+	opts.DirPath = destDir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	_, err = db.Get(utils.GetTestKey(10))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := db.Get(utils.GetTestKey(11))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+
+	// 目标目录不为空
+	_, err = Repair(dir, destDir)
+	assert.NotNil(t, err)
+}
+
+func TestVerify_TruncatedRecord(t *testing.T) {
+	dir := prepareVerifyDir(t, "bitcask-go-verify-truncated", 10)
+	defer os.RemoveAll(dir)
+
+	// 最后一条记录没有写完整
+	fileName := data.GetDataFileName(dir, 0)
+	info, err := os.Stat(fileName)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Truncate(fileName, info.Size()-5))
+
+	report, err := Verify(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 9, report.Records)
+	assert.Equal(t, 1, len(report.CorruptRecords))
+	assert.Equal(t, errIncompleteRecord, report.CorruptRecords[0].Err)
+}
+
+func TestVerify_UncommittedTxn(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-verify-txn")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	_ = wb.Put(utils.GetTestKey(1), utils.RandomValue(10))
+	assert.Nil(t, wb.Commit())
+	// 没有完成标识的事务
+	for i := 0; i < 3; i++ {
+		_, err = db.appendLogRecordWithLock(&data.LogRecord{
+			Key:   logRecordKeyWithSeq(utils.GetTestKey(i), 100),
+			Value: utils.RandomValue(10),
+		}, DefaultWriteOptions)
+		assert.Nil(t, err)
+	}
+
+	report, err := Verify(dir)
+	assert.Nil(t, err)
+	assert.True(t, report.Healthy())
+	assert.Equal(t, uint64(100), report.MaxSeqNo)
+	assert.Equal(t, 1, len(report.UncommittedTxns))
+	assert.Equal(t, uint64(100), report.UncommittedTxns[0].SeqNo)
+	assert.Equal(t, 3, report.UncommittedTxns[0].Records)
+
+	destDir, _ := os.MkdirTemp("", "bitcask-go-verify-txn-repair")
+	defer os.RemoveAll(destDir)
+	repairReport, err := Repair(dir, destDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, repairReport.Keys)
+	assert.Equal(t, 3, repairReport.DroppedRecords)
+}
+
+func TestVerify_HintAndMergeDir(t *testing.T) {
+	dir := prepareVerifyDir(t, "bitcask-go-verify-hint", 10)
+	defer os.RemoveAll(dir)
+
+	// hint 索引指向了文件末尾之后的位置
+	hintFile, err := data.OpenHintFile(fio.OSFS{}, dir)
+	assert.Nil(t, err)
+	assert.Nil(t, hintFile.WriteHintRecord(utils.GetTestKey(1), &data.LogRecordPos{Fid: 0, Offset: 1 << 20, Size: 10}))
+	assert.Nil(t, hintFile.WriteHintRecord(utils.GetTestKey(2), &data.LogRecordPos{Fid: 0, Offset: 0, Size: 10}))
+	assert.Nil(t, hintFile.Close())
+
+	// 遗留的没有完成的 merge 目录
+	mergePath := getMergePath(dir)
+	assert.Nil(t, os.MkdirAll(mergePath, os.ModePerm))
+	defer os.RemoveAll(mergePath)
+	assert.Nil(t, os.WriteFile(filepath.Join(mergePath, "000000000.data"), []byte("a"), fio.DataFilePerm))
+
+	report, err := Verify(dir)
+	assert.Nil(t, err)
+	assert.False(t, report.Healthy())
+	assert.Equal(t, 2, report.HintRecords)
+	assert.Equal(t, 2, len(report.InvalidHints))
+	assert.Equal(t, utils.GetTestKey(1), report.InvalidHints[0].Key)
+	assert.Equal(t, "points to a record of another key", report.InvalidHints[1].Reason)
+	assert.NotNil(t, report.MergeDir)
+	assert.False(t, report.MergeDir.Finished)
+	assert.Equal(t, []string{"000000000.data"}, report.MergeDir.Files)
+}
+
+func TestVerifyWithFS(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = "/bitcask-go-verify-memfs"
+	opts.FS = fio.NewMemFS()
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(100))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.Close())
+
+	report, err := VerifyWithFS(opts.FS, opts.DirPath)
+	assert.Nil(t, err)
+	assert.True(t, report.Healthy())
+	assert.Equal(t, 100, report.Records)
+
+	var records int
+	err = InspectFile(data.GetDataFileName(opts.DirPath, 0), InspectOptions{FS: opts.FS}, func(record *InspectRecord) bool {
+		records++
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 100, records)
+
+	repairReport, err := RepairWithFS(opts.FS, opts.DirPath, "/bitcask-go-verify-memfs-repair")
+	assert.Nil(t, err)
+	assert.Equal(t, 100, repairReport.Keys)
+	_, err = os.Stat("/bitcask-go-verify-memfs-repair")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRepairWithOptions_Comparator(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = "/bitcask-go-repair-comparator"
+	opts.FS = fio.NewMemFS()
+	opts.Comparator = reverseComparator{}
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(100)))
+	}
+	assert.Nil(t, db.Close())
+
+	// 使用默认的比较器修复时返回错误
+	_, err = RepairWithFS(opts.FS, opts.DirPath, "/bitcask-go-repair-comparator-default")
+	assert.True(t, errors.Is(err, ErrComparatorMismatch))
+
+	repairOpts := opts
+	repairOpts.DirPath = "/bitcask-go-repair-comparator-dest"
+	repairOpts.DataFileSize = 4 * 1024
+	repairReport, err := RepairWithOptions(opts.DirPath, repairOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, repairReport.Keys)
+
+	// 修复之后的目录可以使用原来的比较器打开，数据文件的大小按照传入的配置
+	db, err = Open(repairOpts)
+	assert.Nil(t, err)
+	keys := db.ListKeys()
+	assert.Equal(t, 100, len(keys))
+	assert.Equal(t, utils.GetTestKey(99), keys[0])
+	assert.True(t, db.Stat().DataFileNum > 1)
+	assert.Nil(t, db.Close())
+}
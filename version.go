@@ -0,0 +1,227 @@
+package bitcask_go
+
+import (
+	"bitcask-go/data"
+	"bitcask-go/index"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Version key 的一个历史版本
+type Version struct {
+	SeqNo     uint64    // 写入时的序列号
+	Timestamp time.Time // 写入时间，开启多版本之前写入的数据为零值
+	Value     []byte    // 删除操作的 value 为空
+	Deleted   bool      // 是否是删除操作
+}
+
+// 内存中保存的一个版本，value 根据位置从数据文件中读取
+type keyVersion struct {
+	seqNo     uint64
+	timestamp int64 // 写入时间，单位为纳秒
+	pos       *data.LogRecordPos
+	deleted   bool
+}
+
+// SeqNo 返回最新的序列号，开启多版本时每次写入都会分配一个新的序列号
+func (db *DB) SeqNo() uint64 {
+	return atomic.LoadUint64(&db.seqNo)
+}
+
+// GetAt 读取 key 在序列号为 seqNo 时的数据
+// key 在这时不存在、已经被删除，或者对应的版本没有被保留时返回 ErrKeyNotFound
+func (db *DB) GetAt(key []byte, seqNo uint64) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	if !db.versioned() {
+		return nil, ErrVersioningDisabled
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	version := versionAt(db.retainedVersions(db.versions[string(key)], time.Now()), seqNo)
+	if version == nil || version.deleted {
+		return nil, ErrKeyNotFound
+	}
+	return db.getValueByPosition(version.pos)
+}
+
+// History 返回 key 保留的所有版本，包括删除操作，按照序列号从旧到新排列
+func (db *DB) History(key []byte) ([]Version, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	if !db.versioned() {
+		return nil, ErrVersioningDisabled
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	versions := db.retainedVersions(db.versions[string(key)], time.Now())
+	if len(versions) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	history := make([]Version, 0, len(versions))
+	for _, v := range versions {
+		version := Version{SeqNo: v.seqNo, Deleted: v.deleted}
+		if v.timestamp != 0 {
+			version.Timestamp = time.Unix(0, v.timestamp)
+		}
+		if !v.deleted {
+			value, err := db.getValueByPosition(v.pos)
+			if err != nil {
+				return nil, err
+			}
+			version.Value = value
+		}
+		history = append(history, version)
+	}
+	return history, nil
+}
+
+// 是否开启了多版本
+func (db *DB) versioned() bool {
+	return db.options.RetainVersions > 0 || db.options.RetainVersionAge > 0
+}
+
+// 为写入的记录加上序列号和写入时间，返回对应的版本，写入之后再设置版本的位置
+// 需要持有 db.mu，保证序列号按照写入的顺序递增
+func withVersion(logRecord *data.LogRecord, seqNo uint64, timestamp int64) *keyVersion {
+	version := &keyVersion{seqNo: seqNo, timestamp: timestamp, deleted: logRecord.Type == data.LogRecordDeleted}
+	if version.deleted {
+		logRecord.Type = data.LogRecordVersionDeleted
+	} else {
+		logRecord.Type = data.LogRecordVersioned
+	}
+	logRecord.Value = data.EncodeVersionedValue(seqNo, timestamp, logRecord.Value)
+	return version
+}
+
+// 根据数据文件中的记录构造版本，没有版本信息的记录使用事务序列号，写入时间为零值
+func newKeyVersion(logRecord *data.LogRecord, seqNo uint64, pos *data.LogRecordPos) *keyVersion {
+	version := &keyVersion{seqNo: seqNo, pos: pos, deleted: data.IsDeletedType(logRecord.Type)}
+	if logRecord.Type == data.LogRecordVersioned || logRecord.Type == data.LogRecordVersionDeleted {
+		version.seqNo, version.timestamp, _ = data.DecodeVersionedValue(logRecord.Value)
+	}
+	return version
+}
+
+// 记录 key 的一个新版本，并按照保留策略清理旧的版本，清理掉的版本可以在 merge 时回收
+func (db *DB) addVersion(key []byte, version *keyVersion) {
+	versions := db.versions[string(key)]
+	// 没有版本信息的记录可能写在带有版本信息的记录之后，保证序列号不会减小
+	if n := len(versions); n > 0 && version.seqNo < versions[n-1].seqNo {
+		version.seqNo = versions[n-1].seqNo
+	}
+	versions = append(versions, version)
+
+	retained := db.retainedVersions(versions, time.Now())
+	for _, v := range versions[:len(versions)-len(retained)] {
+		db.reclaimSize += int64(v.pos.Size)
+	}
+	if len(retained) == 0 {
+		delete(db.versions, string(key))
+		return
+	}
+	db.versions[string(key)] = retained
+}
+
+// 清理按照 RetainVersionAge 已经过期的版本，并计入可以回收的数据量
+// 过期的版本只在 key 写入时清理，之后没有再写入的 key 需要在统计和 merge 之前清理，需要持有 db.mu
+func (db *DB) expireVersions(now time.Time) {
+	if db.options.RetainVersionAge <= 0 {
+		return
+	}
+	for key, versions := range db.versions {
+		retained := db.retainedVersions(versions, now)
+		if len(retained) == len(versions) {
+			continue
+		}
+		for _, v := range versions[:len(versions)-len(retained)] {
+			db.reclaimSize += int64(v.pos.Size)
+		}
+		if len(retained) == 0 {
+			delete(db.versions, key)
+			continue
+		}
+		db.versions[key] = retained
+	}
+}
+
+// 按照保留策略返回需要保留的版本，保留的总是最新的若干个版本
+// 最前面的删除操作不会影响读取的结果，不需要保留
+func (db *DB) retainedVersions(versions []*keyVersion, now time.Time) []*keyVersion {
+	start := len(versions) - 1
+	if db.options.RetainVersions > 0 && len(versions)-db.options.RetainVersions < start {
+		start = len(versions) - db.options.RetainVersions
+	}
+	if db.options.RetainVersionAge > 0 {
+		minTimestamp := now.Add(-db.options.RetainVersionAge).UnixNano()
+		for i := 0; i < start; i++ {
+			if versions[i].timestamp >= minTimestamp {
+				start = i
+				break
+			}
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	for start < len(versions) && versions[start].deleted {
+		start++
+	}
+	return versions[start:]
+}
+
+// merge 时判断 pos 位置上的记录是否是 key 需要保留的版本
+func (db *DB) versionRetained(key []byte, pos *data.LogRecordPos) bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, version := range db.retainedVersions(db.versions[string(key)], time.Now()) {
+		if version.pos.Fid == pos.Fid && version.pos.Offset == pos.Offset {
+			return true
+		}
+	}
+	return false
+}
+
+// 遍历序列号为 seqNo 时的快照，取出所有可见的 key 并按照比较器排序
+func (db *DB) versionIterator(seqNo uint64, reverse bool, comparator index.Comparator) index.Iterator {
+	type item struct {
+		key []byte
+		pos *data.LogRecordPos
+	}
+	var items []item
+	now := time.Now()
+	db.mu.RLock()
+	for key, versions := range db.versions {
+		version := versionAt(db.retainedVersions(versions, now), seqNo)
+		if version != nil && !version.deleted {
+			items = append(items, item{key: []byte(key), pos: version.pos})
+		}
+	}
+	db.mu.RUnlock()
+
+	sort.Slice(items, func(i, j int) bool {
+		return comparator.Compare(items[i].key, items[j].key) < 0
+	})
+	keys := make([][]byte, len(items))
+	positions := make([]*data.LogRecordPos, len(items))
+	for i, item := range items {
+		keys[i], positions[i] = item.key, item.pos
+	}
+	return index.NewSliceIterator(keys, positions, reverse, comparator)
+}
+
+// 查找序列号为 seqNo 时可见的版本，即序列号小于等于 seqNo 的最新版本
+func versionAt(versions []*keyVersion, seqNo uint64) *keyVersion {
+	i := sort.Search(len(versions), func(i int) bool {
+		return versions[i].seqNo > seqNo
+	})
+	if i == 0 {
+		return nil
+	}
+	return versions[i-1]
+}
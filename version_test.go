@@ -0,0 +1,281 @@
+package bitcask_go
+
+import (
+	"bitcask-go/utils"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDB_History(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-history")
+	opts.DirPath = dir
+	opts.RetainVersions = 3
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	key := utils.GetTestKey(1)
+	var seqNos []uint64
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, db.Put(key, []byte(fmt.Sprintf("value-%d", i))))
+		seqNos = append(seqNos, db.SeqNo())
+	}
+	assert.Nil(t, db.Delete(key))
+	deleteSeqNo := db.SeqNo()
+	assert.Nil(t, db.Put(key, []byte("value-5")))
+
+	check := func(db *DB) {
+		// 只保留最近的 3 个版本
+		history, err := db.History(key)
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(history))
+		assert.Equal(t, []byte("value-4"), history[0].Value)
+		assert.Equal(t, seqNos[4], history[0].SeqNo)
+		assert.True(t, history[1].Deleted)
+		assert.Equal(t, deleteSeqNo, history[1].SeqNo)
+		assert.Equal(t, []byte("value-5"), history[2].Value)
+		for _, version := range history {
+			assert.False(t, version.Timestamp.IsZero())
+		}
+
+		val, err := db.GetAt(key, seqNos[4])
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value-4"), val)
+		_, err = db.GetAt(key, deleteSeqNo)
+		assert.Equal(t, ErrKeyNotFound, err)
+		val, err = db.GetAt(key, db.SeqNo())
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value-5"), val)
+		// 没有保留的版本
+		_, err = db.GetAt(key, seqNos[3])
+		assert.Equal(t, ErrKeyNotFound, err)
+
+		_, err = db.History(utils.GetTestKey(2))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	check(db)
+
+	// 重启之后从数据文件中加载保留的版本
+	assert.Nil(t, db.Close())
+	db2, err := Open(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+	check(db2)
+	assert.Equal(t, deleteSeqNo+1, db2.SeqNo())
+}
+
+func TestDB_RetainVersionAge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-history-age")
+	opts.DirPath = dir
+	opts.RetainVersionAge = 200 * time.Millisecond
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	key := utils.GetTestKey(1)
+	assert.Nil(t, db.Put(key, []byte("value-0")))
+	assert.Nil(t, db.Put(key, []byte("value-1")))
+	time.Sleep(300 * time.Millisecond)
+	assert.Nil(t, db.Put(key, []byte("value-2")))
+	assert.Nil(t, db.Put(key, []byte("value-3")))
+
+	history, err := db.History(key)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, []byte("value-2"), history[0].Value)
+	assert.Equal(t, []byte("value-3"), history[1].Value)
+
+	// 超过时间的版本即使没有新的写入也不再可见，最新的版本总是被保留
+	time.Sleep(300 * time.Millisecond)
+	history, err = db.History(key)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history))
+	assert.Equal(t, []byte("value-3"), history[0].Value)
+}
+
+func TestDB_IteratorAsOfSeqNo(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-iterator-as-of")
+	opts.DirPath = dir
+	opts.RetainVersions = 10
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), []byte(fmt.Sprintf("value-%d", i))))
+	}
+	seqNo := db.SeqNo()
+
+	// 批量写入的数据使用同一个序列号
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, wb.Put(utils.GetTestKey(0), []byte("new-value-0")))
+	assert.Nil(t, wb.Delete(utils.GetTestKey(1)))
+	assert.Nil(t, wb.Put(utils.GetTestKey(10), []byte("value-10")))
+	assert.Nil(t, wb.Commit())
+	assert.Equal(t, seqNo+1, db.SeqNo())
+
+	val, err := db.GetAt(utils.GetTestKey(0), seqNo)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value-0"), val)
+	val, err = db.GetAt(utils.GetTestKey(1), seqNo)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value-1"), val)
+	_, err = db.GetAt(utils.GetTestKey(10), seqNo)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	iterOpts := DefaultIteratorOptions
+	iterOpts.AsOfSeqNo = seqNo
+	iter := db.NewIterator(iterOpts)
+	var keys [][]byte
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		keys = append(keys, iter.Key())
+		val, err := iter.Value()
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("value-%d", len(keys)-1), string(val))
+	}
+	iter.Close()
+	assert.Equal(t, 10, len(keys))
+
+	// 之后的写入对快照不可见
+	assert.Nil(t, db.Put(utils.GetTestKey(2), []byte("new-value-2")))
+	iterOpts.Reverse = true
+	iter = db.NewIterator(iterOpts)
+	iter.Seek(utils.GetTestKey(2))
+	assert.True(t, iter.Valid())
+	assert.Equal(t, utils.GetTestKey(2), iter.Key())
+	val, err = iter.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value-2"), val)
+	iter.Next()
+	assert.Equal(t, utils.GetTestKey(1), iter.Key())
+	iter.Close()
+
+	// 最新的数据
+	iter = db.NewIterator(DefaultIteratorOptions)
+	var count int
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		count++
+	}
+	iter.Close()
+	assert.Equal(t, 10, count)
+}
+
+func TestDB_MergeVersions(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-versions")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.RetainVersions = 2
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for n := 0; n < 5; n++ {
+		for i := 0; i < 200; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), []byte(fmt.Sprintf("value-%d-%d", i, n))))
+		}
+	}
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	history, err := db.History(utils.GetTestKey(150))
+	assert.Nil(t, err)
+	diskSize := db.Stat().DiskSize
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	// merge 之后保留的版本和写入时的序列号、写入时间保持不变
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.True(t, db.recovery.MergeApplied)
+	assert.True(t, db.Stat().DiskSize < diskSize)
+	assert.Equal(t, 100, len(db.ListKeys()))
+	history2, err := db.History(utils.GetTestKey(150))
+	assert.Nil(t, err)
+	assert.Equal(t, history, history2)
+	assert.Equal(t, 2, len(history2))
+	assert.Equal(t, "value-150-3", string(history2[0].Value))
+
+	// 删除的 key 保留删除之前的版本
+	history, err = db.History(utils.GetTestKey(50))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, "value-50-4", string(history[0].Value))
+	assert.True(t, history[1].Deleted)
+	_, err = db.Get(utils.GetTestKey(50))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Close())
+
+	// 不开启多版本时从 hint 文件中加载最新的数据
+	opts.RetainVersions = 0
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(db.ListKeys()))
+	val, err := db.Get(utils.GetTestKey(150))
+	assert.Nil(t, err)
+	assert.Equal(t, "value-150-4", string(val))
+	_, err = db.History(utils.GetTestKey(150))
+	assert.Equal(t, ErrVersioningDisabled, err)
+}
+
+func TestDB_MergeVersionAge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-version-age")
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0.5
+	opts.RetainVersionAge = 200 * time.Millisecond
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// 写入之后不再更新的 key，旧的版本只会因为过期而失效
+	for n := 0; n < 5; n++ {
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), []byte(fmt.Sprintf("value-%d-%d", i, n))))
+		}
+	}
+	assert.Equal(t, int64(0), db.Stat().ReclaimableSize)
+	assert.Equal(t, ErrMergeRatioUnreached, db.Merge())
+
+	time.Sleep(300 * time.Millisecond)
+	stat := db.Stat()
+	assert.True(t, stat.ReclaimableSize > stat.DiskSize/2)
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.True(t, db.recovery.MergeApplied)
+	assert.True(t, db.Stat().DiskSize < stat.DiskSize/2)
+	history, err := db.History(utils.GetTestKey(50))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history))
+	assert.Equal(t, "value-50-4", string(history[0].Value))
+}
+
+func TestDB_VersioningOptions(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-versioning-options")
+	opts.DirPath = dir
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	opts.RetainVersions = -1
+	_, err := Open(opts)
+	assert.NotNil(t, err)
+
+	opts.RetainVersions = 1
+	opts.IndexType = BPlusTree
+	_, err = Open(opts)
+	assert.Equal(t, ErrVersioningNotSupported, err)
+}